@@ -0,0 +1,67 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/service"
+)
+
+// runArchive 命令行模式：处理本地 ZIP 图片包并写出结果包，不依赖 Redis
+// 用法：layerkit archive [-max-foreground-only] [-shape-descriptors] <input.zip> <output.zip>
+func runArchive(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	maxForegroundOnly := fs.Bool("max-foreground-only", false, "仅保留最大的前景连通区域")
+	shapeDescriptors := fs.Bool("shape-descriptors", false, "计算形状描述")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: layerkit archive [-max-foreground-only] [-shape-descriptors] <input.zip> <output.zip>")
+	}
+	input, output := fs.Arg(0), fs.Arg(1)
+
+	r, err := zip.OpenReader(input)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer r.Close()
+
+	service.SetPixelLimits(&cfg.Upload)
+	grabCut := service.NewGrabCutService(&cfg.GrabCut, &cfg.Upload)
+	processor := service.NewArchiveProcessor(grabCut, nil, &cfg.Archive, &cfg.Upload)
+	if _, err := processor.Inspect(&r.Reader); err != nil {
+		return err
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+
+	opts := service.ProcessOptions{
+		MaxForegroundOnly: *maxForegroundOnly,
+		ShapeDescriptors:  *shapeDescriptors,
+	}
+	summary, err := processor.Process(context.Background(), &r.Reader, out, opts)
+	if err != nil {
+		out.Close()
+		os.Remove(output)
+		return fmt.Errorf("failed to process archive: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	for _, entry := range summary.Entries {
+		if entry.Error != "" {
+			fmt.Printf("FAIL %s: %s\n", entry.Path, entry.Error)
+		}
+	}
+	fmt.Printf("processed %d, failed %d, written to %s\n", summary.Processed, summary.Failed, output)
+	return nil
+}
@@ -8,10 +8,18 @@ import (
 )
 
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	Redis   RedisConfig   `mapstructure:"redis"`
-	Upload  UploadConfig  `mapstructure:"upload"`
-	GrabCut GrabCutConfig `mapstructure:"grabcut"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Upload    UploadConfig    `mapstructure:"upload"`
+	GrabCut   GrabCutConfig   `mapstructure:"grabcut"`
+	Framing   FramingConfig   `mapstructure:"framing"`
+	Debug     DebugConfig     `mapstructure:"debug"`
+	Fetch     FetchConfig     `mapstructure:"fetch"`
+	Archive   ArchiveConfig   `mapstructure:"archive"`
+	Sequence  SequenceConfig  `mapstructure:"sequence"`
+	Resumable ResumableConfig `mapstructure:"resumable"`
+	Retention RetentionConfig `mapstructure:"retention"`
+	Jobs      JobsConfig      `mapstructure:"jobs"`
 }
 
 type ServerConfig struct {
@@ -29,17 +37,94 @@ type RedisConfig struct {
 }
 
 type UploadConfig struct {
-	MaxSize      int64    `mapstructure:"max_size"`
-	UploadDir    string   `mapstructure:"upload_dir"`
-	AllowedTypes []string `mapstructure:"allowed_types"`
+	MaxSize       int64    `mapstructure:"max_size"`
+	UploadDir     string   `mapstructure:"upload_dir"`
+	AllowedTypes  []string `mapstructure:"allowed_types"`
+	KeepGPS       bool     `mapstructure:"keep_gps"`
+	MaxBatchItems int      `mapstructure:"max_batch_items"` // 批量上传单次最多的图片数
+	MaxBatchSize  int64    `mapstructure:"max_batch_size"`  // 批量上传图片合计上限（字节）
+	// 像素限制在解码前按文件头中的尺寸检查，防止小文件解码出超大图像
+	MaxWidth         int     `mapstructure:"max_width"`         // 宽度上限（像素），0 为不限制
+	MaxHeight        int     `mapstructure:"max_height"`        // 高度上限（像素），0 为不限制
+	MaxMegapixels    float64 `mapstructure:"max_megapixels"`    // 总像素上限（百万像素），0 为不限制
+	DecodeMegapixels float64 `mapstructure:"decode_megapixels"` // 超过时按 1/2、1/4、1/8 缩小解码，0 为始终全尺寸解码
 }
 
 type GrabCutConfig struct {
-	Iterations       int  `mapstructure:"iterations"`
-	BorderSize       int  `mapstructure:"border_size"`
-	MaxConcurrent    int  `mapstructure:"max_concurrent"`
-	QueueTimeout     int  `mapstructure:"queue_timeout"`
-	CleanupTempFiles bool `mapstructure:"cleanup_temp_files"`
+	Iterations      int    `mapstructure:"iterations"`
+	BorderSize      int    `mapstructure:"border_size"`
+	MaxConcurrent   int    `mapstructure:"max_concurrent"`
+	QueueTimeout    int    `mapstructure:"queue_timeout"`
+	MaskOrientation string `mapstructure:"mask_orientation"` // 掩码返回方向：upright（按 EXIF 转正）或 stored（存储方向）
+	AlphaPrior      string `mapstructure:"alpha_prior"`      // 透明通道的使用方式：auto、cutout、seed 或 ignore
+}
+
+type FramingConfig struct {
+	Presets map[string]FramingPreset `mapstructure:"presets"`
+}
+
+// FramingPreset 商品图构图预设（如各电商平台的主图规范）
+type FramingPreset struct {
+	Aspect     string  `mapstructure:"aspect"`     // 宽高比，如 1:1、4:5、16:9
+	Width      int     `mapstructure:"width"`      // 输出宽度，高度按宽高比计算
+	FillRatio  float64 `mapstructure:"fill_ratio"` // 主体占画面的比例（按较紧的一边计算）
+	Padding    float64 `mapstructure:"padding"`    // 四周最小留白占画面的比例
+	Background string  `mapstructure:"background"` // 背景颜色
+	Format     string  `mapstructure:"format"`     // 输出格式
+}
+
+// DebugConfig 管线调试追踪（debug=true）的开关
+type DebugConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否允许调试请求
+	Token   string `mapstructure:"token"`   // 非空时调试请求需在 X-Debug-Token 头中携带该值
+}
+
+// FetchConfig 通过 image_url 拉取远程图片的限制，大小上限沿用 upload.max_size
+type FetchConfig struct {
+	AllowedHosts   []string      `mapstructure:"allowed_hosts"`   // 允许的主机，*.example.com 匹配其子域名；为空时禁用 URL 拉取
+	AllowedSchemes []string      `mapstructure:"allowed_schemes"` // 允许的协议
+	Timeout        time.Duration `mapstructure:"timeout"`         // 整个拉取过程（含重定向和读取响应体）的超时
+	MaxRedirects   int           `mapstructure:"max_redirects"`   // 最多跟随的重定向次数，每一跳都重新校验协议和主机
+	AllowPrivate   bool          `mapstructure:"allow_private"`   // 允许连接内网和回环地址，仅用于本地开发
+}
+
+// ArchiveConfig ZIP 图片包的大小和解压限制，单个条目大小上限沿用 upload.max_size
+type ArchiveConfig struct {
+	MaxSize      int64 `mapstructure:"max_size"`       // 上传的 ZIP 文件大小上限（字节）
+	MaxEntries   int   `mapstructure:"max_entries"`    // 文件条目数上限
+	MaxTotalSize int64 `mapstructure:"max_total_size"` // 所有条目解压后的总大小上限（字节）
+	MaxRatio     int   `mapstructure:"max_ratio"`      // 单个条目的最大压缩比，超过视为 zip 炸弹
+}
+
+// SequenceConfig 动图和帧序列分层的限制
+type SequenceConfig struct {
+	MaxFrames          int     `mapstructure:"max_frames"`           // 帧数上限
+	MaxTotalMegapixels float64 `mapstructure:"max_total_megapixels"` // 帧数乘以每帧像素的上限（百万像素），0 表示不限制
+	DefaultDelay       int     `mapstructure:"default_delay"`        // ZIP 帧序列未指定 delay 时每帧的显示时长（毫秒）
+}
+
+// ResumableConfig tus 断点续传上传的限制，分片保存在 upload.upload_dir 下
+type ResumableConfig struct {
+	MaxSize         int64         `mapstructure:"max_size"`         // 单个上传的大小上限（字节），不受 upload.max_size 限制
+	Expiration      time.Duration `mapstructure:"expiration"`       // 上传自最后一次写入起的保留时长，过期的未完成上传会被清理
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"` // 清理过期上传的间隔
+}
+
+// RetentionConfig 按内容 MD5 保留原图，用于重新渲染、以新参数重新处理和导出
+type RetentionConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`          // 是否保留原图
+	Dir             string        `mapstructure:"dir"`              // 保留目录，按 MD5 前两级分片
+	TTL             time.Duration `mapstructure:"ttl"`              // 自最后一次访问起的保留时长，0 为不过期
+	MaxSize         int64         `mapstructure:"max_size"`         // 总大小配额（字节），超出时淘汰最久未访问的原图，0 为不限制
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"` // 清理过期原图的间隔
+}
+
+// JobsConfig 异步分层任务，任务状态和排队中的图片保存在 Redis 中，所有实例共享同一队列
+type JobsConfig struct {
+	Workers    int           `mapstructure:"workers"`     // 每个实例执行任务的并发数，0 为不执行任务（仅接收和查询）
+	MaxQueue   int           `mapstructure:"max_queue"`   // 排队任务数上限，超出时拒绝提交
+	TTL        time.Duration `mapstructure:"ttl"`         // 任务状态的保留时长，完成后重新计时
+	InstanceID string        `mapstructure:"instance_id"` // 实例标识，用于命名处理中列表，重启后据此找回未完成的任务；为空时使用主机名
 }
 
 // Load 从 YAML 文件加载配置
@@ -88,15 +173,64 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("upload.max_size", 10*1024*1024)
 	v.SetDefault("upload.upload_dir", "./uploads")
 	v.SetDefault("upload.allowed_types", []string{"image/jpeg", "image/png", "image/jpg"})
+	v.SetDefault("upload.keep_gps", false)
+	v.SetDefault("upload.max_batch_items", 100)
+	v.SetDefault("upload.max_batch_size", 200*1024*1024)
+	v.SetDefault("upload.max_width", 20000)
+	v.SetDefault("upload.max_height", 20000)
+	v.SetDefault("upload.max_megapixels", 100)
+	v.SetDefault("upload.decode_megapixels", 25)
 
 	v.SetDefault("grabcut.iterations", 5)
 	v.SetDefault("grabcut.border_size", 10)
 	v.SetDefault("grabcut.max_concurrent", 3)
 	v.SetDefault("grabcut.queue_timeout", 60)
-	v.SetDefault("grabcut.cleanup_temp_files", true)
 	v.SetDefault("grabcut.max_concurrent", 3)
 	v.SetDefault("grabcut.queue_timeout", 30)
-	v.SetDefault("grabcut.cleanup_temp_files", true)
+	v.SetDefault("grabcut.mask_orientation", "upright")
+	v.SetDefault("grabcut.alpha_prior", "auto")
+
+	v.SetDefault("framing.presets", defaultFramingPresets())
+
+	v.SetDefault("debug.enabled", false)
+	v.SetDefault("debug.token", "")
+
+	v.SetDefault("fetch.allowed_hosts", []string{})
+	v.SetDefault("fetch.allowed_schemes", []string{"https"})
+	v.SetDefault("fetch.timeout", 10*time.Second)
+	v.SetDefault("fetch.max_redirects", 3)
+	v.SetDefault("fetch.allow_private", false)
+
+	v.SetDefault("archive.max_size", 500*1024*1024)
+	v.SetDefault("archive.max_entries", 500)
+	v.SetDefault("archive.max_total_size", 2*1024*1024*1024)
+	v.SetDefault("archive.max_ratio", 100)
+
+	v.SetDefault("sequence.max_frames", 120)
+	v.SetDefault("sequence.max_total_megapixels", 300)
+	v.SetDefault("sequence.default_delay", 100)
+
+	v.SetDefault("resumable.max_size", 100*1024*1024)
+	v.SetDefault("resumable.expiration", 24*time.Hour)
+	v.SetDefault("resumable.cleanup_interval", 10*time.Minute)
+
+	v.SetDefault("retention.enabled", false)
+	v.SetDefault("retention.dir", "./uploads/originals")
+	v.SetDefault("retention.ttl", 7*24*time.Hour)
+	v.SetDefault("retention.max_size", 5*1024*1024*1024)
+	v.SetDefault("retention.cleanup_interval", 10*time.Minute)
+	v.SetDefault("jobs.workers", 2)
+	v.SetDefault("jobs.max_queue", 1000)
+	v.SetDefault("jobs.ttl", time.Hour)
+	v.SetDefault("jobs.instance_id", "")
+}
+
+func defaultFramingPresets() map[string]FramingPreset {
+	return map[string]FramingPreset{
+		"square":    {Aspect: "1:1", Width: 2000, FillRatio: 0.85, Padding: 0.05, Background: "#ffffff", Format: "jpg"},
+		"portrait":  {Aspect: "4:5", Width: 1600, FillRatio: 0.8, Padding: 0.05, Background: "#ffffff", Format: "jpg"},
+		"landscape": {Aspect: "16:9", Width: 1920, FillRatio: 0.8, Padding: 0.05, Background: "#ffffff", Format: "jpg"},
+	}
 }
 
 func getDefaultConfig() *Config {
@@ -114,16 +248,58 @@ func getDefaultConfig() *Config {
 			TTL:      24 * time.Hour,
 		},
 		Upload: UploadConfig{
-			MaxSize:      10 * 1024 * 1024,
-			UploadDir:    "./uploads",
-			AllowedTypes: []string{"image/jpeg", "image/png", "image/jpg"},
+			MaxSize:          10 * 1024 * 1024,
+			UploadDir:        "./uploads",
+			AllowedTypes:     []string{"image/jpeg", "image/png", "image/jpg"},
+			MaxBatchItems:    100,
+			MaxBatchSize:     200 * 1024 * 1024,
+			MaxWidth:         20000,
+			MaxHeight:        20000,
+			MaxMegapixels:    100,
+			DecodeMegapixels: 25,
 		},
 		GrabCut: GrabCutConfig{
-			Iterations:       5,
-			BorderSize:       10,
-			MaxConcurrent:    3,
-			QueueTimeout:     30,
-			CleanupTempFiles: true,
+			Iterations:      5,
+			BorderSize:      10,
+			MaxConcurrent:   3,
+			QueueTimeout:    30,
+			MaskOrientation: "upright",
+			AlphaPrior:      "auto",
+		},
+		Framing: FramingConfig{
+			Presets: defaultFramingPresets(),
+		},
+		Fetch: FetchConfig{
+			AllowedSchemes: []string{"https"},
+			Timeout:        10 * time.Second,
+			MaxRedirects:   3,
+		},
+		Archive: ArchiveConfig{
+			MaxSize:      500 * 1024 * 1024,
+			MaxEntries:   500,
+			MaxTotalSize: 2 * 1024 * 1024 * 1024,
+			MaxRatio:     100,
+		},
+		Sequence: SequenceConfig{
+			MaxFrames:          120,
+			MaxTotalMegapixels: 300,
+			DefaultDelay:       100,
+		},
+		Resumable: ResumableConfig{
+			MaxSize:         100 * 1024 * 1024,
+			Expiration:      24 * time.Hour,
+			CleanupInterval: 10 * time.Minute,
+		},
+		Retention: RetentionConfig{
+			Dir:             "./uploads/originals",
+			TTL:             7 * 24 * time.Hour,
+			MaxSize:         5 * 1024 * 1024 * 1024,
+			CleanupInterval: 10 * time.Minute,
+		},
+		Jobs: JobsConfig{
+			Workers:  2,
+			MaxQueue: 1000,
+			TTL:      time.Hour,
 		},
 	}
 }
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ArchiveHandler 处理多图输入：ZIP 图片包和动图/帧序列
+type ArchiveHandler struct {
+	upload    *UploadHandler
+	processor *service.ArchiveProcessor
+}
+
+func NewArchiveHandler(upload *UploadHandler, processor *service.ArchiveProcessor) *ArchiveHandler {
+	return &ArchiveHandler{
+		upload:    upload,
+		processor: processor,
+	}
+}
+
+// Archive 处理上传的 ZIP 图片包，返回目录结构一致的掩码和抠图包
+func (h *ArchiveHandler) Archive(c *gin.Context) {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		formFileError(c, "请上传 ZIP 文件", err)
+		return
+	}
+
+	r, _, closeArchive, ok := h.openArchive(c, false)
+	if !ok {
+		return
+	}
+	defer closeArchive()
+
+	// 开始写入结果包之前检查限制，超出时仍可返回 JSON 错误
+	if _, err := h.processor.Inspect(r); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+			Success: false,
+			Message: "ZIP 文件超出处理限制",
+			Code:    model.ErrCodeFileTooLarge,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	opts := h.upload.processOptions(c)
+	name := strings.TrimSuffix(filepath.Base(file.Filename), filepath.Ext(file.Filename))
+	if name == "" || name == "." {
+		name = "archive"
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-layers.zip"`, strings.ReplaceAll(name, `"`, "")))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	summary, err := h.processor.Process(c.Request.Context(), r, c.Writer, opts)
+	if err != nil {
+		// 响应已开始写入，只能中断
+		utils.Logger.Error("failed to process archive", zap.Error(err))
+		return
+	}
+
+	utils.Logger.Info("archive processed",
+		zap.String("filename", file.Filename),
+		zap.Int("processed", summary.Processed),
+		zap.Int("failed", summary.Failed))
+}
+
+// Sequence 对动图（image 字段，GIF）或帧序列（archive 字段，编号的帧图片 ZIP）逐帧分层
+// 后一帧以前一帧的掩码初始化，前景不会在帧间闪烁；output 为 json、mask_gif 或 cutout_gif
+func (h *ArchiveHandler) Sequence(c *gin.Context) {
+	output := c.DefaultPostForm("output", service.SequenceOutputJSON)
+	if output != service.SequenceOutputJSON && output != service.SequenceOutputMaskGIF && output != service.SequenceOutputCutoutGIF {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Success: false,
+			Message: "参数错误",
+			Error:   fmt.Sprintf("output must be %s, %s or %s", service.SequenceOutputJSON, service.SequenceOutputMaskGIF, service.SequenceOutputCutoutGIF),
+		})
+		return
+	}
+
+	var frames service.FrameSource
+	var md5 string
+	var ok bool
+	if _, err := c.FormFile("archive"); err == nil {
+		frames, md5, ok = h.archiveFrames(c)
+	} else {
+		frames, md5, ok = h.gifFrames(c)
+	}
+	if !ok {
+		return
+	}
+
+	// 动图输出随分层逐帧编码，不保留已处理的帧
+	var writer *service.SequenceGIFWriter
+	var onFrame service.SequenceFrameFunc
+	if output != service.SequenceOutputJSON {
+		writer, _ = service.NewSequenceGIFWriter(output)
+		onFrame = writer.Add
+	}
+
+	opts := service.ProcessOptions{
+		MaxForegroundOnly: c.DefaultPostForm("max_foreground_only", "false") == "true",
+	}
+	result, err := h.upload.grabCutService.ProcessSequence(frames, md5, opts, onFrame)
+	if err != nil {
+		sequenceFailed(c, err)
+		return
+	}
+
+	if output == service.SequenceOutputJSON {
+		c.JSON(http.StatusOK, model.SequenceResponse{
+			Success: true,
+			Message: "处理成功",
+			Data:    result,
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/gif", writer.Bytes())
+}
+
+// gifFrames 读取 image 字段中的 GIF 动图并切分帧，解码前检查帧数和像素预算；失败时已写入错误响应
+func (h *ArchiveHandler) gifFrames(c *gin.Context) (service.FrameSource, string, bool) {
+	data, imageType, ok := h.upload.formImage(c, "image")
+	if !ok {
+		return nil, "", false
+	}
+	if imageType.Format != "gif" {
+		c.JSON(http.StatusUnsupportedMediaType, model.ErrorResponse{
+			Success: false,
+			Message: "序列分层仅支持 GIF 动图或帧图片 ZIP",
+			Code:    model.ErrCodeUnsupportedType,
+		})
+		return nil, "", false
+	}
+
+	frames, err := service.NewGIFFrames(data, h.upload.cfg.Sequence.MaxFrames, h.sequencePixels())
+	if err != nil {
+		sequenceFailed(c, err)
+		return nil, "", false
+	}
+	return frames, utils.BytesMD5(data), true
+}
+
+// archiveFrames 读取 archive 字段中的帧图片 ZIP 并按文件名排序，解码前检查帧尺寸和像素预算；失败时已写入错误响应
+func (h *ArchiveHandler) archiveFrames(c *gin.Context) (service.FrameSource, string, bool) {
+	p := formParams{c: c}
+	delay := p.int("delay", h.upload.cfg.Sequence.DefaultDelay)
+	if p.err == nil && (delay < 10 || delay > 10000) {
+		p.err = fmt.Errorf("delay must be in [10, 10000]")
+	}
+	if p.err != nil {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Success: false,
+			Message: "参数错误",
+			Error:   p.err.Error(),
+		})
+		return nil, "", false
+	}
+
+	r, md5, closeArchive, ok := h.openArchive(c, true)
+	if !ok {
+		return nil, "", false
+	}
+	defer closeArchive()
+
+	images, err := h.processor.ReadFrames(r, h.upload.cfg.Sequence.MaxFrames)
+	if err != nil {
+		sequenceFailed(c, err)
+		return nil, "", false
+	}
+	frames, err := service.NewImageFrames(images, delay, h.sequencePixels())
+	if err != nil {
+		sequenceFailed(c, err)
+		return nil, "", false
+	}
+	return frames, md5, true
+}
+
+// sequencePixels 返回整个序列的像素预算，0 表示不限制
+func (h *ArchiveHandler) sequencePixels() int64 {
+	return int64(h.upload.cfg.Sequence.MaxTotalMegapixels * 1e6)
+}
+
+// sequenceFailed 根据错误类型返回 400、413 或 500（ZIP 超限或帧尺寸超限）
+func sequenceFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidParam):
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Success: false,
+			Message: "参数错误",
+			Error:   err.Error(),
+		})
+	case errors.Is(err, service.ErrArchiveTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+			Success: false,
+			Message: "ZIP 文件超出处理限制",
+			Code:    model.ErrCodeFileTooLarge,
+			Error:   err.Error(),
+		})
+	case errors.Is(err, service.ErrImageTooLarge):
+		processError(err).abort(c)
+	default:
+		utils.Logger.Error("failed to process sequence", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+			Success: false,
+			Message: "图片处理失败",
+			Error:   err.Error(),
+		})
+	}
+}
+
+// openArchive 打开 archive 字段中的 ZIP 文件，withMD5 为 true 时同时计算其 MD5；失败时已写入错误响应
+// 成功时返回的 closer 需在使用完 Reader 后调用
+func (h *ArchiveHandler) openArchive(c *gin.Context, withMD5 bool) (*zip.Reader, string, func(), bool) {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		formFileError(c, "请上传 ZIP 文件", err)
+		return nil, "", nil, false
+	}
+
+	maxSize := h.upload.cfg.Archive.MaxSize
+	if file.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+			Success: false,
+			Message: fmt.Sprintf("ZIP 文件大小超过限制 (%d MB)", maxSize/(1024*1024)),
+			Code:    model.ErrCodeFileTooLarge,
+		})
+		return nil, "", nil, false
+	}
+
+	f, err := file.Open()
+	var md5 string
+	if err == nil && withMD5 {
+		md5, err = utils.ReaderMD5(f)
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		utils.Logger.Error("failed to read file", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+			Success: false,
+			Message: "读取文件失败",
+			Error:   err.Error(),
+		})
+		return nil, "", nil, false
+	}
+
+	r, err := zip.NewReader(f, file.Size)
+	if err != nil {
+		f.Close()
+		c.JSON(http.StatusUnsupportedMediaType, model.ErrorResponse{
+			Success: false,
+			Message: "不是有效的 ZIP 文件",
+			Code:    model.ErrCodeUnsupportedType,
+			Error:   err.Error(),
+		})
+		return nil, "", nil, false
+	}
+
+	return r, md5, func() { f.Close() }, true
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// batchIntakeConcurrency 批量上传中同时接收（保存、拉取 URL、查询缓存）的条目数
+const batchIntakeConcurrency = 8
+
+// batchSource 批量上传中的一个条目，file 和 url 二选一
+type batchSource struct {
+	file *memoryFile
+	url  string
+}
+
+func (s batchSource) name() string {
+	if s.file != nil {
+		return s.file.filename
+	}
+	return s.url
+}
+
+// batchEntry 已通过校验但缓存未命中、等待处理的条目
+type batchEntry struct {
+	index int
+	data  []byte
+	md5   string
+}
+
+// Batch 批量处理多张图片（多个 image 文件字段和/或多个 image_url），逐条返回结果
+// 单条失败不影响其余条目；缓存命中的条目在接收阶段直接完成，不占用处理名额
+func (h *UploadHandler) Batch(c *gin.Context) {
+	files, err := h.formFiles(c, "image")
+	if err != nil {
+		formFileError(c, "请上传图片文件或提供 image_url", err)
+		return
+	}
+
+	var sources []batchSource
+	for _, file := range files {
+		sources = append(sources, batchSource{file: file})
+	}
+	for _, url := range c.PostFormArray("image_url") {
+		if url != "" {
+			sources = append(sources, batchSource{url: url})
+		}
+	}
+
+	if len(sources) == 0 {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Success: false,
+			Message: "请上传图片文件或提供 image_url",
+			Code:    model.ErrCodeMissingFile,
+		})
+		return
+	}
+	if len(sources) > h.cfg.Upload.MaxBatchItems {
+		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+			Success: false,
+			Message: fmt.Sprintf("单次最多处理 %d 张图片", h.cfg.Upload.MaxBatchItems),
+			Code:    model.ErrCodeInvalidRequest,
+		})
+		return
+	}
+
+	opts := h.processOptions(c)
+	ctx := c.Request.Context()
+	items := make([]model.BatchItem, len(sources))
+
+	// 接收阶段：校验并查询缓存，命中的条目直接完成并释放图片数据
+	pending := make([]batchEntry, 0, len(sources))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, batchIntakeConcurrency)
+	for i, src := range sources {
+		items[i] = model.BatchItem{Index: i, Source: src.name()}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			data, md5, reqErr := h.loadSource(ctx, src)
+			if reqErr != nil {
+				failItem(&items[i], reqErr)
+				return
+			}
+			items[i].MD5 = md5
+
+			result, err := h.redisService.GetLayerResult(ctx, opts.CacheKey(md5))
+			if err != nil {
+				utils.Logger.Warn("failed to get cache", zap.Error(err))
+			}
+			if result != nil {
+				items[i].Success, items[i].Cached, items[i].Data = true, true, result
+				return
+			}
+
+			mu.Lock()
+			pending = append(pending, batchEntry{index: i, data: data, md5: md5})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// 处理阶段：worker 数与 GrabCutService 的并发上限一致，避免大批量请求在信号量上排队超时
+	h.processBatch(ctx, pending, items, opts)
+
+	succeeded := 0
+	for _, item := range items {
+		if item.Success {
+			succeeded++
+		}
+	}
+
+	utils.Logger.Info("batch processed",
+		zap.Int("items", len(items)),
+		zap.Int("processed", len(pending)),
+		zap.Int("failed", len(items)-succeeded))
+
+	c.JSON(http.StatusOK, model.BatchResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("处理完成：成功 %d，失败 %d", succeeded, len(items)-succeeded),
+		Succeeded: succeeded,
+		Failed:    len(items) - succeeded,
+		Items:     items,
+	})
+}
+
+// processBatch 处理缓存未命中的条目，同一批次中内容相同的图片只处理一次
+func (h *UploadHandler) processBatch(ctx context.Context, pending []batchEntry, items []model.BatchItem, opts service.ProcessOptions) {
+	groups := make(map[string][]batchEntry)
+	var order []string
+	for _, entry := range pending {
+		if _, ok := groups[entry.md5]; !ok {
+			order = append(order, entry.md5)
+		}
+		groups[entry.md5] = append(groups[entry.md5], entry)
+	}
+
+	jobs := make(chan []batchEntry)
+	var wg sync.WaitGroup
+	for range max(1, min(h.cfg.GrabCut.MaxConcurrent, len(order))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				first := group[0]
+				result, _, err := h.layers(ctx, first.data, first.md5, opts)
+				for _, entry := range group {
+					if err != nil {
+						failItem(&items[entry.index], processError(err))
+						continue
+					}
+					items[entry.index].Success, items[entry.index].Data = true, result
+				}
+			}
+		}()
+	}
+	for _, md5 := range order {
+		jobs <- groups[md5]
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// failItem 将单图接口的错误响应记录到批量条目
+func failItem(item *model.BatchItem, reqErr *requestError) {
+	item.Success = false
+	item.Status = reqErr.status
+	item.Code = reqErr.resp.Code
+	item.Message = reqErr.resp.Message
+	item.Error = reqErr.resp.Error
+}
+
+// loadSource 读取并校验批量上传中的一个条目
+func (h *UploadHandler) loadSource(ctx context.Context, src batchSource) ([]byte, string, *requestError) {
+	if src.file != nil {
+		if src.file.tooLarge {
+			return nil, "", h.tooLargeError()
+		}
+		return h.loadUpload(src.file)
+	}
+	return h.loadURL(ctx, src.url)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// jobRetryAfter 建议客户端轮询任务状态的间隔（秒）
+const jobRetryAfter = "2"
+
+// JobHandler 异步分层任务：提交后立即返回任务 ID，客户端轮询状态和结果，不受网关写超时限制
+type JobHandler struct {
+	upload *UploadHandler
+	queue  *service.JobQueue
+}
+
+func NewJobHandler(upload *UploadHandler, queue *service.JobQueue) *JobHandler {
+	return &JobHandler{
+		upload: upload,
+		queue:  queue,
+	}
+}
+
+// StartWorkers 启动本实例执行任务的工作协程
+func (h *JobHandler) StartWorkers(workers int) {
+	h.queue.Start(workers, h.run)
+}
+
+// Create 提交异步任务，参数与单图上传相同（不支持 debug），返回 202 和任务 ID
+func (h *JobHandler) Create(c *gin.Context) {
+	data, md5, ok := h.upload.receive(c, "请上传图片文件或提供 image_url")
+	if !ok {
+		return
+	}
+	opts := h.upload.processOptions(c)
+
+	job, err := h.queue.Submit(context.Background(), data, md5, opts)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	utils.Logger.Info("job submitted",
+		zap.String("id", job.ID),
+		zap.String("md5", md5),
+		zap.Int("queue_position", job.QueuePosition))
+
+	c.Header("Location", c.FullPath()+"/"+job.ID)
+	c.Header("Retry-After", jobRetryAfter)
+	c.JSON(http.StatusAccepted, model.JobResponse{
+		Success: true,
+		Message: "任务已提交",
+		Data:    job,
+	})
+}
+
+// Get 查询任务状态；完成后 result 为分层结果，失败时 error 为与同步接口相同的错误响应
+func (h *JobHandler) Get(c *gin.Context) {
+	job, err := h.queue.Get(context.Background(), c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	if job.Status == model.JobQueued || job.Status == model.JobRunning {
+		c.Header("Retry-After", jobRetryAfter)
+	}
+	c.JSON(http.StatusOK, model.JobResponse{
+		Success: true,
+		Message: "查询成功",
+		Data:    job,
+	})
+}
+
+// run 在工作协程中执行任务，与同步上传共用缓存；任务已在队列中排过队，等待处理名额不受 queue_timeout 限制
+func (h *JobHandler) run(ctx context.Context, data []byte, md5 string, opts service.ProcessOptions) (*model.LayerResult, bool, *model.ErrorResponse) {
+	process := func(data []byte, md5 string, opts service.ProcessOptions) (*model.LayerResult, error) {
+		return h.upload.grabCutService.ProcessQueuedData(ctx, data, md5, opts)
+	}
+	result, cached, err := h.upload.layersWith(ctx, data, md5, opts, process)
+	if err != nil {
+		resp := processError(err).resp
+		return nil, false, &resp
+	}
+	return result, cached, nil
+}
+
+// fail 根据错误类型写入对应状态码的错误响应
+func (h *JobHandler) fail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, model.ErrorResponse{
+			Success: false,
+			Message: "任务不存在或已过期",
+		})
+	case errors.Is(err, service.ErrQueueFull):
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, model.ErrorResponse{
+			Success: false,
+			Message: "排队任务过多，请稍后重试",
+			Code:    model.ErrCodeQueueFull,
+		})
+	default:
+		// 任务状态只保存在 Redis 中，Redis 不可用时无法提交或查询
+		utils.Logger.Error("job queue unavailable", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, model.ErrorResponse{
+			Success: false,
+			Message: "任务队列不可用",
+			Error:   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/gin-gonic/gin"
+)
+
+// memoryFormKey 上下文中保存流式读取的文件字段的键
+const memoryFormKey = "layerkit.memoryForm"
+
+// maxFormValuesSize multipart 表单中非文件字段的总大小上限
+const maxFormValuesSize = 1 << 20
+
+// errFileTooLarge 文件字段超过 upload.max_size
+var errFileTooLarge = errors.New("file too large")
+
+// errFormTooLarge 表单中文件字段的总大小超过上限
+var errFormTooLarge = errors.New("form files too large")
+
+// memoryFile 读入内存的上传文件，MD5 在读取时同时计算
+// 超过单文件上限的文件不保留内容，只记录 tooLarge，由处理器决定整体失败还是单条失败
+type memoryFile struct {
+	filename    string
+	contentType string
+	data        []byte
+	md5         string
+	tooLarge    bool
+}
+
+// MemoryForm 流式读取 multipart 表单，文件字段读入内存并在读取时计算 MD5，不产生临时文件
+// 普通字段写入 Request.PostForm，之后 c.PostForm 照常可用；非 multipart 请求原样交给处理器
+func (h *UploadHandler) MemoryForm(c *gin.Context) {
+	h.memoryForm(c, 0)
+}
+
+// BatchMemoryForm 批量上传使用的 MemoryForm，所有文件字段合计不超过 upload.max_batch_size
+func (h *UploadHandler) BatchMemoryForm(c *gin.Context) {
+	h.memoryForm(c, h.cfg.Upload.MaxBatchSize)
+}
+
+// memoryForm maxTotalSize 为 0 时文件总大小只受请求体上限约束
+func (h *UploadHandler) memoryForm(c *gin.Context, maxTotalSize int64) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.Next()
+		return
+	}
+
+	files, values, err := readMemoryForm(reader, h.cfg.Upload.MaxSize, maxTotalSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, errFormTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+				Success: false,
+				Message: fmt.Sprintf("文件总大小超过限制 (%d MB)", maxTotalSize/(1024*1024)),
+				Code:    model.ErrCodeFileTooLarge,
+			})
+		default:
+			formFileError(c, "读取表单失败", err)
+		}
+		c.Abort()
+		return
+	}
+
+	c.Request.PostForm = values
+	c.Request.Form = make(url.Values)
+	for key, vs := range values {
+		c.Request.Form[key] = append(c.Request.Form[key], vs...)
+	}
+	for key, vs := range c.Request.URL.Query() {
+		c.Request.Form[key] = append(c.Request.Form[key], vs...)
+	}
+	c.Set(memoryFormKey, files)
+	c.Next()
+}
+
+// formFile 获取文件字段（同名字段取第一个）：经过 MemoryForm 的请求从内存中读取，其余请求读取 multipart 表单后载入内存
+// 字段不存在时返回 http.ErrMissingFile，超过 upload.max_size 时返回 errFileTooLarge
+func (h *UploadHandler) formFile(c *gin.Context, field string) (*memoryFile, error) {
+	if files, ok := c.Get(memoryFormKey); ok {
+		list := files.(map[string][]*memoryFile)[field]
+		if len(list) == 0 {
+			return nil, http.ErrMissingFile
+		}
+		if list[0].tooLarge {
+			return nil, errFileTooLarge
+		}
+		return list[0], nil
+	}
+
+	header, err := c.FormFile(field)
+	if err != nil {
+		return nil, err
+	}
+	return h.loadFileHeader(header)
+}
+
+// formFiles 获取同名的全部文件字段，超过 upload.max_size 的文件以 tooLarge 标记返回
+// 未经过 MemoryForm 的非 multipart 请求返回空列表
+func (h *UploadHandler) formFiles(c *gin.Context, field string) ([]*memoryFile, error) {
+	if files, ok := c.Get(memoryFormKey); ok {
+		return files.(map[string][]*memoryFile)[field], nil
+	}
+
+	form, err := c.MultipartForm()
+	if errors.Is(err, http.ErrNotMultipart) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*memoryFile, 0, len(form.File[field]))
+	for _, header := range form.File[field] {
+		file, err := h.loadFileHeader(header)
+		if errors.Is(err, errFileTooLarge) {
+			file = &memoryFile{filename: header.Filename, tooLarge: true}
+		} else if err != nil {
+			return nil, err
+		}
+		list = append(list, file)
+	}
+	return list, nil
+}
+
+// loadFileHeader 将已解析的 multipart 文件读入内存
+func (h *UploadHandler) loadFileHeader(header *multipart.FileHeader) (*memoryFile, error) {
+	if header.Size > h.cfg.Upload.MaxSize {
+		return nil, errFileTooLarge
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, md5, err := readHashed(f, h.cfg.Upload.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryFile{
+		filename:    header.Filename,
+		contentType: header.Header.Get("Content-Type"),
+		data:        data,
+		md5:         md5,
+	}, nil
+}
+
+// readMemoryForm 读取整个 multipart 表单，同名文件字段按顺序全部保留
+// 单个文件超过 maxFileSize 时丢弃其内容并标记 tooLarge；保留的文件合计超过 maxTotalSize（大于 0 时）返回 errFormTooLarge
+func readMemoryForm(reader *multipart.Reader, maxFileSize, maxTotalSize int64) (map[string][]*memoryFile, url.Values, error) {
+	files := make(map[string][]*memoryFile)
+	values := make(url.Values)
+	remaining := int64(maxFormValuesSize)
+	var total int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return files, values, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, remaining+1))
+			part.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			remaining -= int64(len(value))
+			if remaining < 0 {
+				return nil, nil, fmt.Errorf("form values exceed %d bytes", maxFormValuesSize)
+			}
+			values.Add(name, string(value))
+			continue
+		}
+
+		file := &memoryFile{
+			filename:    part.FileName(),
+			contentType: part.Header.Get("Content-Type"),
+		}
+		file.data, file.md5, err = readHashed(part, maxFileSize)
+		if errors.Is(err, errFileTooLarge) {
+			// 剩余内容仍需读完才能继续读取后面的字段，总量由请求体上限约束
+			file.tooLarge = true
+			_, err = io.Copy(io.Discard, part)
+		}
+		part.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		total += int64(len(file.data))
+		if maxTotalSize > 0 && total > maxTotalSize {
+			return nil, nil, errFormTooLarge
+		}
+		files[name] = append(files[name], file)
+	}
+}
+
+// readHashed 读取至多 maxSize 字节并同时计算 MD5，超出时返回 errFileTooLarge
+func readHashed(r io.Reader, maxSize int64) ([]byte, string, error) {
+	hash := md5.New()
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.TeeReader(io.LimitReader(r, maxSize+1), hash))
+	if err != nil {
+		return nil, "", err
+	}
+	if n > maxSize {
+		return nil, "", errFileTooLarge
+	}
+	return buf.Bytes(), hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+	"go.uber.org/zap"
+)
+
+const (
+	MIMEMsgPack  = "application/msgpack"
+	MIMEMsgPack2 = "application/x-msgpack"
+	MIMEProtobuf = "application/x-protobuf"
+)
+
+// respond 根据 Accept 头选择 JSON（默认）、MessagePack 或 Protobuf 编码分层结果
+// 二进制编码中的掩码为原始 PNG 字节，省去 Base64 的体积和解析开销
+func respond(c *gin.Context, code int, resp model.UploadResponse) {
+	switch c.NegotiateFormat(binding.MIMEJSON, MIMEMsgPack, MIMEMsgPack2, MIMEProtobuf) {
+	case MIMEMsgPack, MIMEMsgPack2:
+		binary, err := resp.ToBinary()
+		if err != nil {
+			encodeFailed(c, err)
+			return
+		}
+
+		// WriteExt 使 []byte 按 msgpack bin 类型编码
+		var data []byte
+		handle := codec.MsgpackHandle{WriteExt: true}
+		if err := codec.NewEncoderBytes(&data, &handle).Encode(binary); err != nil {
+			encodeFailed(c, err)
+			return
+		}
+		c.Data(code, MIMEMsgPack, data)
+
+	case MIMEProtobuf:
+		data, err := resp.MarshalProto()
+		if err != nil {
+			encodeFailed(c, err)
+			return
+		}
+		c.Data(code, MIMEProtobuf, data)
+
+	default:
+		c.JSON(code, resp)
+	}
+}
+
+func encodeFailed(c *gin.Context, err error) {
+	utils.Logger.Error("failed to encode response", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+		Success: false,
+		Message: "响应编码失败",
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,388 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RenderHandler 基于分层结果在服务端渲染图像
+type RenderHandler struct {
+	upload     *UploadHandler
+	compositor *service.Compositor
+	bokeh      *service.BokehRenderer
+	sticker    *service.StickerRenderer
+	framer     *service.ProductFramer
+	overlay    *service.OverlayRenderer
+}
+
+func NewRenderHandler(upload *UploadHandler) *RenderHandler {
+	return &RenderHandler{
+		upload:     upload,
+		compositor: service.NewCompositor(),
+		bokeh:      service.NewBokehRenderer(),
+		sticker:    service.NewStickerRenderer(),
+		framer:     service.NewProductFramer(),
+		overlay:    service.NewOverlayRenderer(),
+	}
+}
+
+// Composite 替换背景并返回合成后的图像
+func (h *RenderHandler) Composite(c *gin.Context) {
+	spec := service.CompositeSpec{
+		Background:   c.DefaultPostForm("background", "color"),
+		Color:        c.DefaultPostForm("color", "#ffffff"),
+		GradientFrom: c.PostForm("gradient_from"),
+		GradientTo:   c.PostForm("gradient_to"),
+		Fit:          c.DefaultPostForm("fit", "cover"),
+		Anchor:       c.DefaultPostForm("anchor", "original"),
+		Format:       c.DefaultPostForm("format", "png"),
+	}
+
+	p := formParams{c: c}
+	spec.GradientAngle = p.float("gradient_angle", 0)
+	spec.Scale = p.float("scale", 1.0)
+	spec.BlurRadius = p.int("blur_radius", 25)
+	spec.Feather = p.int("feather", 3)
+	spec.OffsetX = p.int("offset_x", 0)
+	spec.OffsetY = p.int("offset_y", 0)
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	if spec.Background == "image" {
+		data, _, ok := h.upload.formImage(c, "background_image")
+		if !ok {
+			return
+		}
+		spec.BackgroundImage = data
+	}
+
+	imageData, result, ok := h.upload.source(c)
+	if !ok {
+		return
+	}
+
+	output, contentType, err := h.compositor.Composite(imageData, result, spec)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// Bokeh 导出背景虚化（人像模式）图像
+func (h *RenderHandler) Bokeh(c *gin.Context) {
+	p := formParams{c: c}
+	spec := service.BokehSpec{
+		Radius:  p.int("radius", 21),
+		Falloff: p.int("falloff", 0),
+		Feather: p.int("feather", 2),
+		Format:  c.DefaultPostForm("format", "jpg"),
+	}
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	imageData, result, ok := h.upload.source(c)
+	if !ok {
+		return
+	}
+
+	output, contentType, err := h.bokeh.Render(imageData, result, spec)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// Sticker 将前景主体渲染为带描边和投影的透明贴纸
+func (h *RenderHandler) Sticker(c *gin.Context) {
+	p := formParams{c: c}
+	spec := service.StickerSpec{
+		OutlineWidth:  p.int("outline_width", 12),
+		OutlineColor:  c.DefaultPostForm("outline_color", "#ffffff"),
+		Shadow:        c.DefaultPostForm("shadow", "true") == "true",
+		ShadowColor:   c.DefaultPostForm("shadow_color", "#000000"),
+		ShadowOffsetX: p.int("shadow_offset_x", 4),
+		ShadowOffsetY: p.int("shadow_offset_y", 6),
+		ShadowBlur:    p.int("shadow_blur", 8),
+		ShadowOpacity: p.float("shadow_opacity", 0.35),
+		Size:          c.DefaultPostForm("size", "whatsapp"),
+		Format:        c.DefaultPostForm("format", "webp"),
+	}
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	imageData, result, ok := h.upload.source(c)
+	if !ok {
+		return
+	}
+
+	output, contentType, err := h.sticker.Render(imageData, result, spec)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// Product 按构图预设导出商品主图，表单参数可覆盖预设中的单项
+func (h *RenderHandler) Product(c *gin.Context) {
+	name := c.DefaultPostForm("preset", "square")
+	preset, ok := h.upload.cfg.Framing.Presets[name]
+	if !ok {
+		h.badParam(c, fmt.Errorf("unknown preset %q", name))
+		return
+	}
+
+	p := formParams{c: c}
+	preset.Aspect = c.DefaultPostForm("aspect", preset.Aspect)
+	preset.Width = p.int("width", preset.Width)
+	preset.FillRatio = p.float("fill_ratio", preset.FillRatio)
+	preset.Padding = p.float("padding", preset.Padding)
+	preset.Background = c.DefaultPostForm("background", preset.Background)
+	preset.Format = c.DefaultPostForm("format", preset.Format)
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	imageData, result, ok := h.upload.source(c)
+	if !ok {
+		return
+	}
+
+	output, contentType, err := h.framer.Render(imageData, result, preset)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// Overlay 渲染分层结果的质检叠加预览（着色掩码、轮廓、边界框、人脸框）
+// 保留了原图时叠加在原图上，否则叠加在与原图同尺寸的中性灰画布上，人脸框需要原图因而不绘制
+func (h *RenderHandler) Overlay(c *gin.Context) {
+	p := formParams{c: c, query: true}
+	spec := service.OverlaySpec{
+		Opacity: p.float("opacity", 0.45),
+		MaxSize: p.int("max_size", 1280),
+		Faces:   c.DefaultQuery("faces", "true") == "true",
+	}
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	result, err := h.upload.redisService.GetLayerResult(context.Background(), h.upload.queryOptions(c).CacheKey(c.Param("md5")))
+	if err != nil {
+		utils.Logger.Error("failed to get layer result", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+			Success: false,
+			Message: "查询失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, model.ErrorResponse{
+			Success: false,
+			Message: "未找到该图片的分层信息",
+		})
+		return
+	}
+
+	// 原图不可用时退回灰画布，不影响预览
+	imageData, err := h.upload.original(c.Param("md5"))
+	if err != nil && !errors.Is(err, service.ErrOriginalNotFound) {
+		utils.Logger.Warn("failed to read original", zap.String("md5", c.Param("md5")), zap.Error(err))
+	}
+
+	release, ok := h.acquire(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	output, contentType, err := h.overlay.Render(imageData, result, spec)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// ContactSheet 将多个 MD5 的叠加预览拼接为一张联系表，保留了原图的格叠加在原图上，未找到的结果以空格占位
+// md5 参数可重复或以逗号分隔
+func (h *RenderHandler) ContactSheet(c *gin.Context) {
+	var md5s []string
+	for _, value := range c.QueryArray("md5") {
+		for _, md5 := range strings.Split(value, ",") {
+			if md5 = strings.TrimSpace(md5); md5 != "" {
+				md5s = append(md5s, md5)
+			}
+		}
+	}
+	if len(md5s) == 0 || len(md5s) > service.MaxContactSheetTiles {
+		h.badParam(c, fmt.Errorf("md5 count must be in [1, %d]", service.MaxContactSheetTiles))
+		return
+	}
+
+	p := formParams{c: c, query: true}
+	spec := service.ContactSheetSpec{
+		Columns:  p.int("columns", 6),
+		TileSize: p.int("tile_size", 256),
+		Overlay: service.OverlaySpec{
+			Opacity: p.float("opacity", 0.45),
+		},
+	}
+	if p.err != nil {
+		h.badParam(c, p.err)
+		return
+	}
+
+	ctx := context.Background()
+	opts := h.upload.queryOptions(c)
+	tiles := make([]service.OverlayTile, 0, len(md5s))
+	for _, md5 := range md5s {
+		result, err := h.upload.redisService.GetLayerResult(ctx, opts.CacheKey(md5))
+		if err != nil {
+			utils.Logger.Warn("failed to get layer result", zap.String("md5", md5), zap.Error(err))
+		}
+		tiles = append(tiles, service.OverlayTile{
+			Label:     md5[:min(8, len(md5))],
+			Result:    result,
+			LoadImage: h.tileOriginal(md5),
+		})
+	}
+
+	// 整张联系表占用一个处理名额，各格依次渲染
+	release, ok := h.acquire(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	output, contentType, err := h.overlay.ContactSheet(tiles, spec)
+	if err != nil {
+		h.renderFailed(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, output)
+}
+
+// tileOriginal 返回联系表一格读取原图的函数：没有保留原图时使用灰画布，其他读取错误使该格标为出错
+func (h *RenderHandler) tileOriginal(md5 string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		data, err := h.upload.original(md5)
+		if errors.Is(err, service.ErrOriginalNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			utils.Logger.Warn("failed to read original", zap.String("md5", md5), zap.Error(err))
+		}
+		return data, err
+	}
+}
+
+// acquire 占用一个 GrabCut 处理名额，排队超时返回 503；失败时已写入错误响应
+func (h *RenderHandler) acquire(c *gin.Context) (func(), bool) {
+	release, err := h.upload.grabCutService.Acquire()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, model.ErrorResponse{
+			Success: false,
+			Message: err.Error(),
+			Code:    model.ErrCodeQueueFull,
+		})
+		return nil, false
+	}
+	return release, true
+}
+
+func (h *RenderHandler) badParam(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, model.ErrorResponse{
+		Success: false,
+		Message: "参数错误",
+		Error:   err.Error(),
+	})
+}
+
+// renderFailed 根据错误类型返回参数错误或渲染失败
+func (h *RenderHandler) renderFailed(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidParam) {
+		h.badParam(c, err)
+		return
+	}
+	if errors.Is(err, service.ErrImageTooLarge) {
+		processError(err).abort(c)
+		return
+	}
+
+	utils.Logger.Error("failed to render image", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+		Success: false,
+		Message: "图像渲染失败",
+		Error:   err.Error(),
+	})
+}
+
+// formParams 解析数值型表单参数（query 为 true 时解析查询参数），记录遇到的第一个错误
+type formParams struct {
+	c     *gin.Context
+	query bool
+	err   error
+}
+
+func (p *formParams) value(key string) string {
+	if p.query {
+		return p.c.Query(key)
+	}
+	return p.c.PostForm(key)
+}
+
+func (p *formParams) int(key string, def int) int {
+	value := p.value(key)
+	if value == "" || p.err != nil {
+		return def
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		p.err = fmt.Errorf("%s must be an integer", key)
+		return def
+	}
+	return v
+}
+
+func (p *formParams) float(key string, def float64) float64 {
+	value := p.value(key)
+	if value == "" || p.err != nil {
+		return def
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.err = fmt.Errorf("%s must be a number", key)
+		return def
+	}
+	return v
+}
@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,checksum,termination"
+
+	// statusChecksumMismatch tus checksum 扩展定义的校验和不一致状态码
+	statusChecksumMismatch = 460
+)
+
+// ResumableHandler 实现 tus 1.0.0 断点续传上传协议（creation、expiration、checksum、termination 扩展）
+// 上传完成后通过 GET 获取分层结果，与普通上传走相同的处理流程
+type ResumableHandler struct {
+	upload *UploadHandler
+	store  *service.ResumableStore
+}
+
+func NewResumableHandler(upload *UploadHandler, store *service.ResumableStore) *ResumableHandler {
+	return &ResumableHandler{
+		upload: upload,
+		store:  store,
+	}
+}
+
+// Protocol 为所有响应添加 Tus-Resumable 头，并拒绝协议版本不符的请求
+func (h *ResumableHandler) Protocol(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.Request.Method != http.MethodOptions && c.Request.Method != http.MethodGet &&
+		c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	c.Next()
+}
+
+// Options 返回服务端支持的协议版本、扩展和限制
+func (h *ResumableHandler) Options(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.store.MaxSize(), 10))
+	c.Header("Tus-Checksum-Algorithm", strings.Join(service.ChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// Create 创建上传，Upload-Length 为文件总长度；Upload-Metadata 中的 checksum 为整个文件的校验和
+func (h *ResumableHandler) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		h.fail(c, fmt.Errorf("%w: Upload-Length must be an integer", service.ErrInvalidParam))
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	u, err := h.store.Create(length, metadata)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+
+	utils.Logger.Info("resumable upload created",
+		zap.String("id", u.ID),
+		zap.Int64("length", u.Length),
+		zap.String("filename", metadata["filename"]))
+
+	c.Header("Location", c.FullPath()+"/"+u.ID)
+	c.Header("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// Head 返回已接收的偏移，客户端据此续传
+func (h *ResumableHandler) Head(c *gin.Context) {
+	u, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		// HEAD 响应不能带响应体
+		c.Status(h.status(err))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	c.Header("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// Patch 在 Upload-Offset 处追加一个分片，Upload-Checksum 存在时校验该分片
+// 最后一个分片写入后校验整体校验和和文件类型，不通过时删除上传
+func (h *ResumableHandler) Patch(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, model.ErrorResponse{
+			Success: false,
+			Message: "Content-Type 必须为 application/offset+octet-stream",
+		})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		h.fail(c, fmt.Errorf("%w: Upload-Offset must be an integer", service.ErrInvalidParam))
+		return
+	}
+	var checksum *service.Checksum
+	if value := c.GetHeader("Upload-Checksum"); value != "" {
+		if checksum, err = service.ParseChecksum(value); err != nil {
+			h.fail(c, err)
+			return
+		}
+	}
+
+	id := c.Param("id")
+	u, err := h.store.Append(id, offset, c.Request.Body, checksum)
+	if err != nil {
+		if u != nil {
+			utils.Logger.Warn("resumable upload interrupted",
+				zap.String("id", id),
+				zap.Int64("offset", u.Offset),
+				zap.Error(err))
+		}
+		h.fail(c, err)
+		return
+	}
+
+	if u.Complete() {
+		if reqErr := h.checkType(u); reqErr != nil {
+			if err := h.store.Delete(id); err != nil {
+				utils.Logger.Warn("failed to delete upload", zap.String("id", id), zap.Error(err))
+			}
+			reqErr.abort(c)
+			return
+		}
+		utils.Logger.Info("resumable upload completed",
+			zap.String("id", id),
+			zap.String("md5", u.MD5))
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+// Result 返回已完成上传的分层结果，处理选项取自查询参数
+func (h *ResumableHandler) Result(c *gin.Context) {
+	u, err := h.store.Get(c.Param("id"))
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	if !u.Complete() {
+		c.JSON(http.StatusConflict, model.ErrorResponse{
+			Success: false,
+			Message: fmt.Sprintf("上传未完成（%d/%d 字节）", u.Offset, u.Length),
+		})
+		return
+	}
+
+	data, err := os.ReadFile(h.store.Path(u))
+	if err != nil {
+		utils.Logger.Error("failed to read file", zap.Error(err))
+		internalError("读取文件失败", err).abort(c)
+		return
+	}
+	// 文件类型已在最后一个分片写入后校验
+	imageType, _ := service.DetectImageType(data)
+	h.upload.retain(data, u.MD5, imageType)
+	h.upload.respondLayers(c, data, u.MD5, h.upload.queryOptions(c))
+}
+
+// Delete 终止上传并删除已接收的数据
+func (h *ResumableHandler) Delete(c *gin.Context) {
+	if err := h.store.Delete(c.Param("id")); err != nil {
+		h.fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkType 按普通上传的规则识别已完成上传的文件类型
+func (h *ResumableHandler) checkType(u *service.ResumableUpload) *requestError {
+	f, err := os.Open(h.store.Path(u))
+	if err != nil {
+		return internalError("读取文件失败", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return internalError("读取文件失败", err)
+	}
+	_, reqErr := h.upload.checkType(header[:n])
+	return reqErr
+}
+
+// fail 根据错误类型写入对应状态码的错误响应
+func (h *ResumableHandler) fail(c *gin.Context, err error) {
+	status := h.status(err)
+	resp := model.ErrorResponse{
+		Success: false,
+		Message: "上传失败",
+		Error:   err.Error(),
+	}
+	switch status {
+	case http.StatusBadRequest:
+		resp.Message = "参数错误"
+		resp.Code = model.ErrCodeInvalidRequest
+	case http.StatusNotFound:
+		resp.Message = "上传不存在或已过期"
+	case http.StatusConflict:
+		resp.Message = "上传偏移不一致，请通过 HEAD 查询后续传"
+	case http.StatusLocked:
+		resp.Message = "上传正在写入，请稍后重试"
+	case http.StatusRequestEntityTooLarge:
+		resp.Message = fmt.Sprintf("上传大小超过限制 (%d MB)", h.store.MaxSize()/(1024*1024))
+		resp.Code = model.ErrCodeFileTooLarge
+	case statusChecksumMismatch:
+		resp.Message = "校验和不一致"
+	default:
+		utils.Logger.Error("resumable upload failed", zap.Error(err))
+	}
+	c.JSON(status, resp)
+}
+
+func (h *ResumableHandler) status(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidParam):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrUploadLocked):
+		return http.StatusLocked
+	case errors.Is(err, service.ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrChecksumMismatch):
+		return statusChecksumMismatch
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseUploadMetadata 解析 Upload-Metadata 头：逗号分隔的 "键 Base64值"，值可省略
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("%w: empty Upload-Metadata key", service.ErrInvalidParam)
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: Upload-Metadata value of %q is not base64", service.ErrInvalidParam, key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/service"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Segment 处理 JSON 上传（image_base64 或 image_url），供无法构造 multipart 请求的客户端使用
+// 校验、哈希、缓存和响应与 Upload 一致
+func (h *UploadHandler) Segment(c *gin.Context) {
+	var req model.SegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+				Success: false,
+				Message: fmt.Sprintf("请求体超过限制 (%d MB)", maxBytesErr.Limit/(1024*1024)),
+				Code:    model.ErrCodeFileTooLarge,
+			})
+			return
+		}
+		invalidRequest(c, "请求参数错误", err)
+		return
+	}
+
+	var data []byte
+	var md5 string
+	var ok bool
+	if req.ImageURL != "" {
+		data, md5, ok = h.fetchUpload(c, req.ImageURL)
+	} else {
+		decoded, err := decodeBase64Image(req.ImageBase64)
+		if err != nil {
+			invalidRequest(c, "image_base64 解码失败", err)
+			return
+		}
+		data, md5, ok = h.acceptData(c, decoded)
+	}
+	if !ok {
+		return
+	}
+
+	orientation := req.Orientation
+	if orientation == "" {
+		orientation = h.cfg.GrabCut.MaskOrientation
+	}
+	opts := service.ProcessOptions{
+		MaxForegroundOnly: req.MaxForegroundOnly,
+		ShapeDescriptors:  req.ShapeDescriptors,
+		StoredOrientation: orientation == service.OrientationStored,
+	}
+
+	h.respondLayers(c, data, md5, opts)
+}
+
+// decodeBase64Image 解码 base64 图片数据，支持 data URI（data:image/png;base64,...）和无填充的编码
+// data URI 中声明的类型不参与判断，仍以文件内容为准
+func decodeBase64Image(encoded string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(encoded, "data:"); ok {
+		meta, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, errors.New("data URI must be base64 encoded")
+		}
+		encoded = payload
+	}
+	encoded = strings.TrimRight(strings.TrimSpace(encoded), "=")
+
+	return base64.RawStdEncoding.DecodeString(encoded)
+}
+
+// invalidRequest 写入请求体格式或字段校验失败的错误响应
+func invalidRequest(c *gin.Context, message string, err error) {
+	utils.Logger.Warn("invalid request", zap.Error(err))
+	c.JSON(http.StatusBadRequest, model.ErrorResponse{
+		Success: false,
+		Message: message,
+		Code:    model.ErrCodeInvalidRequest,
+		Error:   err.Error(),
+	})
+}
@@ -2,10 +2,10 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/TIANLI0/LayerKit/config"
@@ -20,105 +20,372 @@ type UploadHandler struct {
 	cfg            *config.Config
 	redisService   *service.RedisService
 	grabCutService *service.GrabCutService
+	fetcher        *service.ImageFetcher
+	originals      *service.OriginalStore // 未开启原图保留时为 nil
 }
 
-func NewUploadHandler(cfg *config.Config, redis *service.RedisService, grabCut *service.GrabCutService) *UploadHandler {
+func NewUploadHandler(cfg *config.Config, redis *service.RedisService, grabCut *service.GrabCutService, fetcher *service.ImageFetcher, originals *service.OriginalStore) *UploadHandler {
 	return &UploadHandler{
 		cfg:            cfg,
 		redisService:   redis,
 		grabCutService: grabCut,
+		fetcher:        fetcher,
+		originals:      originals,
 	}
 }
 
-// Upload 处理图片上传
+// Upload 处理图片上传（image 文件字段或 image_url）
 func (h *UploadHandler) Upload(c *gin.Context) {
-	file, err := c.FormFile("image")
+	debug := c.PostForm("debug") == "true"
+	if debug && !h.debugAllowed(c) {
+		return
+	}
+
+	data, md5, ok := h.receive(c, "请上传图片文件或提供 image_url")
+	if !ok {
+		return
+	}
+
+	// 获取参数
+	opts := h.processOptions(c)
+
+	if debug {
+		h.debugUpload(c, data, md5, opts)
+		return
+	}
+
+	h.respondLayers(c, data, md5, opts)
+}
+
+// respondLayers 获取图片的分层结果并写入响应
+func (h *UploadHandler) respondLayers(c *gin.Context, data []byte, md5 string, opts service.ProcessOptions) {
+	utils.Logger.Info("file uploaded",
+		zap.Int("size", len(data)),
+		zap.String("md5", md5),
+		zap.Bool("max_foreground_only", opts.MaxForegroundOnly),
+		zap.Bool("shape_descriptors", opts.ShapeDescriptors),
+		zap.Bool("stored_orientation", opts.StoredOrientation))
+
+	result, cached, err := h.layers(context.Background(), data, md5, opts)
 	if err != nil {
-		utils.Logger.Error("failed to get uploaded file", zap.Error(err))
-		c.JSON(http.StatusBadRequest, model.ErrorResponse{
-			Success: false,
-			Message: "请上传图片文件",
-			Error:   err.Error(),
-		})
+		processError(err).abort(c)
 		return
 	}
 
-	// 验证文件大小
-	if file.Size > h.cfg.Upload.MaxSize {
-		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+	message := "处理成功"
+	if cached {
+		message = "处理成功（来自缓存）"
+	}
+	respond(c, http.StatusOK, model.UploadResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// debugAllowed 检查调试请求是否被配置允许；不允许时已写入错误响应
+func (h *UploadHandler) debugAllowed(c *gin.Context) bool {
+	if !h.cfg.Debug.Enabled {
+		c.JSON(http.StatusForbidden, model.ErrorResponse{
 			Success: false,
-			Message: fmt.Sprintf("文件大小超过限制 (%d MB)", h.cfg.Upload.MaxSize/(1024*1024)),
+			Message: "调试模式未开启",
 		})
-		return
+		return false
 	}
-
-	// 验证文件类型
-	contentType := file.Header.Get("Content-Type")
-	if !h.isAllowedType(contentType) {
-		c.JSON(http.StatusBadRequest, model.ErrorResponse{
+	token := c.GetHeader("X-Debug-Token")
+	if h.cfg.Debug.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.Debug.Token)) != 1 {
+		c.JSON(http.StatusForbidden, model.ErrorResponse{
 			Success: false,
-			Message: "不支持的文件类型，仅支持 JPEG/PNG",
+			Message: "调试令牌无效",
 		})
+		return false
+	}
+	return true
+}
+
+// debugUpload 绕过缓存重新处理图片，返回包含各阶段中间产物和耗时的 ZIP
+func (h *UploadHandler) debugUpload(c *gin.Context, data []byte, md5 string, opts service.ProcessOptions) {
+	utils.Logger.Info("debug trace requested", zap.String("md5", md5))
+
+	result, trace, err := h.grabCutService.TraceImage(data, md5, opts)
+	if err != nil {
+		processError(err).abort(c)
 		return
 	}
 
-	// 生成文件名
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("%d%s", utils.GenerateID(), ext)
-	savePath := filepath.Join(h.cfg.Upload.UploadDir, filename)
+	// 追踪不影响结果本身，仍写入缓存
+	if err := h.redisService.SetLayerResult(context.Background(), opts.CacheKey(md5), result); err != nil {
+		utils.Logger.Warn("failed to set cache", zap.Error(err))
+	}
 
-	// 保存文件
-	if err := c.SaveUploadedFile(file, savePath); err != nil {
-		utils.Logger.Error("failed to save file", zap.Error(err))
+	bundle, err := trace.Bundle(result)
+	if err != nil {
+		utils.Logger.Error("failed to bundle debug trace", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
 			Success: false,
-			Message: "保存文件失败",
+			Message: "调试数据打包失败",
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	// 计算MD5
-	md5, err := utils.FileMD5(savePath)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-debug.zip"`, md5))
+	c.Data(http.StatusOK, "application/zip", bundle)
+}
+
+// source 获取请求中的原图数据（image 字段、image_url 或已保留原图的 md5）及其分层结果；失败时已写入错误响应
+func (h *UploadHandler) source(c *gin.Context) ([]byte, *model.LayerResult, bool) {
+	data, md5, ok := h.receive(c, "请上传图片文件或提供 image_url")
+	if !ok {
+		return nil, nil, false
+	}
+
+	// 渲染基于转正后的原图，掩码也需要是转正后的方向
+	opts := h.processOptions(c)
+	opts.StoredOrientation = false
+
+	result, _, err := h.layers(context.Background(), data, md5, opts)
 	if err != nil {
-		utils.Logger.Error("failed to calculate md5", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
+		processError(err).abort(c)
+		return nil, nil, false
+	}
+
+	return data, result, true
+}
+
+// receive 获取并校验请求中的图片，image_url 优先于 image 文件字段，两者都未提供时按 md5 查找保留的原图
+// 返回图片数据和MD5；失败时已写入错误响应，missingMessage 为都未提供时的提示
+func (h *UploadHandler) receive(c *gin.Context, missingMessage string) ([]byte, string, bool) {
+	if imageURL := c.PostForm("image_url"); imageURL != "" {
+		return h.fetchUpload(c, imageURL)
+	}
+
+	file, err := h.formFile(c, "image")
+	if errors.Is(err, errFileTooLarge) {
+		h.tooLarge(c)
+		return nil, "", false
+	}
+	if err != nil {
+		if md5 := c.PostForm("md5"); md5 != "" {
+			return h.retained(c, md5)
+		}
+		utils.Logger.Error("failed to get uploaded file", zap.Error(err))
+		formFileError(c, missingMessage, err)
+		return nil, "", false
+	}
+	return h.acceptUpload(c, file)
+}
+
+// retained 读取按 md5 保留的原图；失败时已写入错误响应
+func (h *UploadHandler) retained(c *gin.Context, md5 string) ([]byte, string, bool) {
+	data, err := h.original(md5)
+	if err != nil {
+		originalError(err).abort(c)
+		return nil, "", false
+	}
+	return data, strings.ToLower(md5), true
+}
+
+// original 读取保留的原图，未开启保留时返回 service.ErrOriginalNotFound
+func (h *UploadHandler) original(md5 string) ([]byte, error) {
+	if h.originals == nil {
+		return nil, service.ErrOriginalNotFound
+	}
+	return h.originals.Get(md5)
+}
+
+// originalError 读取保留原图失败的错误响应
+func originalError(err error) *requestError {
+	if errors.Is(err, service.ErrOriginalNotFound) {
+		return &requestError{
+			status: http.StatusNotFound,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "服务端未保留该图片的原图，请通过 image 字段上传原图",
+				Code:    model.ErrCodeOriginalNotFound,
+			},
+		}
+	}
+	utils.Logger.Error("failed to read original", zap.Error(err))
+	return internalError("读取原图失败", err)
+}
+
+// requestError 接收图片失败时的状态码和错误响应
+// 单图接口直接写入响应，批量接口记录到对应条目
+type requestError struct {
+	status int
+	resp   model.ErrorResponse
+}
+
+func (e *requestError) abort(c *gin.Context) {
+	c.JSON(e.status, e.resp)
+}
+
+func internalError(message string, err error) *requestError {
+	return &requestError{
+		status: http.StatusInternalServerError,
+		resp: model.ErrorResponse{
 			Success: false,
-			Message: "计算文件哈希失败",
+			Message: message,
 			Error:   err.Error(),
-		})
-		return
+		},
 	}
+}
 
-	// 确保文件在处理完成后被删除（如果配置启用）
-	if h.cfg.GrabCut.CleanupTempFiles {
-		defer func() {
-			if err := os.Remove(savePath); err != nil {
-				utils.Logger.Warn("failed to delete temp file",
-					zap.String("file", savePath),
-					zap.Error(err))
-			} else {
-				utils.Logger.Debug("temp file deleted",
-					zap.String("file", savePath))
-			}
-		}()
+// processError 将分层处理的错误转换为错误响应，超出像素上限返回 413，无法解析的图片返回 400，其余为 500
+func processError(err error) *requestError {
+	if errors.Is(err, service.ErrInvalidParam) {
+		return &requestError{
+			status: http.StatusBadRequest,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "图片无法解析",
+				Error:   err.Error(),
+			},
+		}
+	}
+	if errors.Is(err, service.ErrImageTooLarge) {
+		return &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "图片尺寸超过限制",
+				Code:    model.ErrCodeImageTooLarge,
+				Error:   err.Error(),
+			},
+		}
 	}
+	utils.Logger.Error("failed to process image", zap.Error(err))
+	return internalError("图片处理失败", err)
+}
 
-	// 获取参数
-	maxForegroundOnly := c.DefaultPostForm("max_foreground_only", "false") == "true"
+// fetchUpload 拉取 image_url 指向的图片并按与上传文件相同的规则校验；失败时已写入错误响应
+func (h *UploadHandler) fetchUpload(c *gin.Context, imageURL string) ([]byte, string, bool) {
+	data, md5, reqErr := h.loadURL(c.Request.Context(), imageURL)
+	if reqErr != nil {
+		reqErr.abort(c)
+		return nil, "", false
+	}
+	return data, md5, true
+}
 
-	utils.Logger.Info("file uploaded",
-		zap.String("filename", filename),
-		zap.String("md5", md5),
-		zap.Int64("size", file.Size),
-		zap.Bool("max_foreground_only", maxForegroundOnly))
+// acceptData 按与上传文件相同的规则校验内存中的图片数据，返回图片数据和MD5；失败时已写入错误响应
+func (h *UploadHandler) acceptData(c *gin.Context, data []byte) ([]byte, string, bool) {
+	data, md5, reqErr := h.loadData(data)
+	if reqErr != nil {
+		reqErr.abort(c)
+		return nil, "", false
+	}
+	return data, md5, true
+}
 
-	// 检查缓存（带参数区分）
-	ctx := context.Background()
-	cacheKey := md5
-	if maxForegroundOnly {
-		cacheKey = md5 + ":max_fg"
+// acceptUpload 校验上传文件，返回图片数据和MD5；失败时已写入错误响应
+func (h *UploadHandler) acceptUpload(c *gin.Context, file *memoryFile) ([]byte, string, bool) {
+	data, md5, reqErr := h.loadUpload(file)
+	if reqErr != nil {
+		reqErr.abort(c)
+		return nil, "", false
 	}
+	return data, md5, true
+}
+
+// loadURL 拉取 image_url 指向的图片并校验
+func (h *UploadHandler) loadURL(ctx context.Context, imageURL string) ([]byte, string, *requestError) {
+	data, err := h.fetcher.Fetch(ctx, imageURL)
+	if err != nil {
+		utils.Logger.Warn("failed to fetch image url",
+			zap.String("url", imageURL),
+			zap.Error(err))
+		return nil, "", fetchError(err)
+	}
+
+	utils.Logger.Info("image url fetched",
+		zap.String("url", imageURL),
+		zap.Int("size", len(data)))
+
+	return h.loadData(data)
+}
+
+// loadData 校验内存中的图片数据
+func (h *UploadHandler) loadData(data []byte) ([]byte, string, *requestError) {
+	if int64(len(data)) > h.cfg.Upload.MaxSize {
+		return nil, "", h.tooLargeError()
+	}
+
+	imageType, reqErr := h.checkType(data)
+	if reqErr != nil {
+		return nil, "", reqErr
+	}
+
+	md5 := utils.BytesMD5(data)
+	h.retain(data, md5, imageType)
+	return data, md5, nil
+}
+
+// loadUpload 校验读入内存的上传文件
+// 文件类型以文件头魔数为准，客户端声明的 Content-Type 和文件名均不参与判断
+func (h *UploadHandler) loadUpload(file *memoryFile) ([]byte, string, *requestError) {
+	if int64(len(file.data)) > h.cfg.Upload.MaxSize {
+		return nil, "", h.tooLargeError()
+	}
+
+	imageType, reqErr := h.checkType(file.data)
+	if reqErr != nil {
+		return nil, "", reqErr
+	}
+	if !strings.EqualFold(file.contentType, imageType.ContentType) {
+		utils.Logger.Debug("declared content type differs from file content",
+			zap.String("declared", file.contentType),
+			zap.String("detected", imageType.ContentType))
+	}
+
+	h.retain(file.data, file.md5, imageType)
+	return file.data, file.md5, nil
+}
+
+// retain 开启原图保留时按 MD5 保存通过校验的原图；保存失败不影响处理
+func (h *UploadHandler) retain(data []byte, md5 string, imageType service.ImageType) {
+	if h.originals == nil {
+		return
+	}
+	if err := h.originals.Put(md5, data, imageType.Ext); err != nil {
+		utils.Logger.Warn("failed to retain original",
+			zap.String("md5", md5),
+			zap.Error(err))
+	}
+}
+
+// formImage 读取并校验附加的图片表单字段；失败时已写入错误响应
+func (h *UploadHandler) formImage(c *gin.Context, field string) ([]byte, service.ImageType, bool) {
+	file, err := h.formFile(c, field)
+	if errors.Is(err, errFileTooLarge) {
+		h.tooLarge(c)
+		return nil, service.ImageType{}, false
+	}
+	if err != nil {
+		formFileError(c, fmt.Sprintf("请上传 %s 图片", field), err)
+		return nil, service.ImageType{}, false
+	}
+
+	imageType, ok := h.detectType(c, file.data)
+	if !ok {
+		return nil, service.ImageType{}, false
+	}
+
+	return file.data, imageType, true
+}
+
+// processFunc 执行分层处理，同步请求和异步任务等待处理名额的方式不同
+type processFunc func(data []byte, md5 string, opts service.ProcessOptions) (*model.LayerResult, error)
+
+// layers 获取分层结果，优先读取缓存（带参数区分），未命中时处理图片并写入缓存
+func (h *UploadHandler) layers(ctx context.Context, data []byte, md5 string, opts service.ProcessOptions) (*model.LayerResult, bool, error) {
+	return h.layersWith(ctx, data, md5, opts, h.grabCutService.ProcessImageData)
+}
+
+// layersWith 与 layers 相同，未命中缓存时由 process 处理图片
+func (h *UploadHandler) layersWith(ctx context.Context, data []byte, md5 string, opts service.ProcessOptions, process processFunc) (*model.LayerResult, bool, error) {
+	cacheKey := opts.CacheKey(md5)
 
 	cachedResult, err := h.redisService.GetLayerResult(ctx, cacheKey)
 	if err != nil {
@@ -127,24 +394,13 @@ func (h *UploadHandler) Upload(c *gin.Context) {
 
 	if cachedResult != nil {
 		utils.Logger.Info("cache hit", zap.String("cache_key", cacheKey))
-		c.JSON(http.StatusOK, model.UploadResponse{
-			Success: true,
-			Message: "处理成功（来自缓存）",
-			Data:    cachedResult,
-		})
-		return
+		return cachedResult, true, nil
 	}
 
 	// 处理图片
-	result, err := h.grabCutService.ProcessImage(savePath, md5, maxForegroundOnly)
+	result, err := process(data, md5, opts)
 	if err != nil {
-		utils.Logger.Error("failed to process image", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
-			Success: false,
-			Message: "图片处理失败",
-			Error:   err.Error(),
-		})
-		return
+		return nil, false, err
 	}
 
 	// 保存到缓存
@@ -152,14 +408,29 @@ func (h *UploadHandler) Upload(c *gin.Context) {
 		utils.Logger.Warn("failed to set cache", zap.Error(err))
 	}
 
-	c.JSON(http.StatusOK, model.UploadResponse{
-		Success: true,
-		Message: "处理成功",
-		Data:    result,
-	})
+	return result, false, nil
+}
+
+// processOptions 从表单参数解析处理选项，orientation 未指定时使用配置
+func (h *UploadHandler) processOptions(c *gin.Context) service.ProcessOptions {
+	return service.ProcessOptions{
+		MaxForegroundOnly: c.DefaultPostForm("max_foreground_only", "false") == "true",
+		ShapeDescriptors:  c.DefaultPostForm("shape_descriptors", "false") == "true",
+		StoredOrientation: c.DefaultPostForm("orientation", h.cfg.GrabCut.MaskOrientation) == service.OrientationStored,
+	}
+}
+
+// queryOptions 从查询参数解析处理选项，用于定位与上传时选项对应的缓存键
+func (h *UploadHandler) queryOptions(c *gin.Context) service.ProcessOptions {
+	return service.ProcessOptions{
+		MaxForegroundOnly: c.Query("max_foreground_only") == "true",
+		ShapeDescriptors:  c.Query("shape_descriptors") == "true",
+		StoredOrientation: c.DefaultQuery("orientation", h.cfg.GrabCut.MaskOrientation) == service.OrientationStored,
+	}
 }
 
 // GetByMD5 根据MD5获取分层信息
+// 缓存未命中但保留了原图时（如以新的处理选项查询）按查询参数重新处理
 func (h *UploadHandler) GetByMD5(c *gin.Context) {
 	md5 := c.Param("md5")
 	if md5 == "" {
@@ -171,7 +442,8 @@ func (h *UploadHandler) GetByMD5(c *gin.Context) {
 	}
 
 	ctx := context.Background()
-	result, err := h.redisService.GetLayerResult(ctx, md5)
+	opts := h.queryOptions(c)
+	result, err := h.redisService.GetLayerResult(ctx, opts.CacheKey(md5))
 	if err != nil {
 		utils.Logger.Error("failed to get layer result", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, model.ErrorResponse{
@@ -183,20 +455,136 @@ func (h *UploadHandler) GetByMD5(c *gin.Context) {
 	}
 
 	if result == nil {
-		c.JSON(http.StatusNotFound, model.ErrorResponse{
-			Success: false,
-			Message: "未找到该图片的分层信息",
-		})
+		data, err := h.original(md5)
+		if err != nil {
+			if !errors.Is(err, service.ErrOriginalNotFound) {
+				utils.Logger.Warn("failed to read original", zap.String("md5", md5), zap.Error(err))
+			}
+			c.JSON(http.StatusNotFound, model.ErrorResponse{
+				Success: false,
+				Message: "未找到该图片的分层信息",
+			})
+			return
+		}
+		h.respondLayers(c, data, strings.ToLower(md5), opts)
 		return
 	}
 
-	c.JSON(http.StatusOK, model.UploadResponse{
+	respond(c, http.StatusOK, model.UploadResponse{
 		Success: true,
 		Message: "查询成功",
 		Data:    result,
 	})
 }
 
+// GetOriginal 按 MD5 返回保留的原图
+func (h *UploadHandler) GetOriginal(c *gin.Context) {
+	data, err := h.original(c.Param("md5"))
+	if err != nil {
+		originalError(err).abort(c)
+		return
+	}
+
+	imageType, _ := service.DetectImageType(data)
+	c.Header("ETag", `"`+strings.ToLower(c.Param("md5"))+`"`)
+	c.Data(http.StatusOK, imageType.ContentType, data)
+}
+
+// detectType 根据文件头识别图片类型并检查配置是否允许；失败时已写入错误响应
+func (h *UploadHandler) detectType(c *gin.Context, header []byte) (service.ImageType, bool) {
+	imageType, reqErr := h.checkType(header)
+	if reqErr != nil {
+		reqErr.abort(c)
+		return service.ImageType{}, false
+	}
+	return imageType, true
+}
+
+func (h *UploadHandler) checkType(header []byte) (service.ImageType, *requestError) {
+	imageType, ok := service.DetectImageType(header)
+	if !ok || !h.isAllowedType(imageType.ContentType) {
+		return service.ImageType{}, &requestError{
+			status: http.StatusUnsupportedMediaType,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: fmt.Sprintf("不支持的文件类型，仅支持 %s", strings.Join(h.cfg.Upload.AllowedTypes, ", ")),
+				Code:    model.ErrCodeUnsupportedType,
+			},
+		}
+	}
+	return imageType, nil
+}
+
+func (h *UploadHandler) tooLarge(c *gin.Context) {
+	h.tooLargeError().abort(c)
+}
+
+func (h *UploadHandler) tooLargeError() *requestError {
+	return &requestError{
+		status: http.StatusRequestEntityTooLarge,
+		resp: model.ErrorResponse{
+			Success: false,
+			Message: fmt.Sprintf("文件大小超过限制 (%d MB)", h.cfg.Upload.MaxSize/(1024*1024)),
+			Code:    model.ErrCodeFileTooLarge,
+		},
+	}
+}
+
+// formFileError 写入读取文件字段失败的错误响应，请求体超过 BodyLimit 时返回 413
+func formFileError(c *gin.Context, message string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+			Success: false,
+			Message: fmt.Sprintf("请求体超过限制 (%d MB)", maxBytesErr.Limit/(1024*1024)),
+			Code:    model.ErrCodeFileTooLarge,
+		})
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, model.ErrorResponse{
+		Success: false,
+		Message: message,
+		Code:    model.ErrCodeMissingFile,
+		Error:   err.Error(),
+	})
+}
+
+// fetchError 拉取 image_url 失败的错误响应
+func fetchError(err error) *requestError {
+	switch {
+	case errors.Is(err, service.ErrURLNotAllowed):
+		return &requestError{
+			status: http.StatusBadRequest,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "不允许拉取该地址",
+				Code:    model.ErrCodeURLNotAllowed,
+				Error:   err.Error(),
+			},
+		}
+	case errors.Is(err, service.ErrFetchTooLarge):
+		return &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "远程文件大小超过限制",
+				Code:    model.ErrCodeFileTooLarge,
+			},
+		}
+	default:
+		return &requestError{
+			status: http.StatusBadGateway,
+			resp: model.ErrorResponse{
+				Success: false,
+				Message: "拉取远程图片失败",
+				Code:    model.ErrCodeFetchFailed,
+				Error:   err.Error(),
+			},
+		}
+	}
+}
+
 func (h *UploadHandler) isAllowedType(contentType string) bool {
 	for _, allowed := range h.cfg.Upload.AllowedTypes {
 		if strings.EqualFold(contentType, allowed) {
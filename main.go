@@ -44,6 +44,15 @@ func main() {
 		utils.Logger.Fatal("failed to create upload directory", zap.Error(err))
 	}
 
+	// 命令行模式
+	if len(os.Args) > 1 && os.Args[1] == "archive" {
+		if err := runArchive(cfg, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 初始化Redis
 	redisService := service.NewRedisService(&cfg.Redis)
 	ctx := context.Background()
@@ -55,10 +64,39 @@ func main() {
 	defer redisService.Close()
 
 	// 初始化GrabCut服务
-	grabCutService := service.NewGrabCutService(&cfg.GrabCut)
+	service.SetPixelLimits(&cfg.Upload)
+	grabCutService := service.NewGrabCutService(&cfg.GrabCut, &cfg.Upload)
+
+	// 远程图片拉取（image_url）
+	imageFetcher := service.NewImageFetcher(&cfg.Fetch, cfg.Upload.MaxSize)
+
+	// 断点续传上传
+	resumableStore, err := service.NewResumableStore(&cfg.Resumable, cfg.Upload.UploadDir)
+	if err != nil {
+		utils.Logger.Fatal("failed to init resumable uploads", zap.Error(err))
+	}
+	resumableStore.StartCleanup(cfg.Resumable.CleanupInterval)
+
+	// 按内容 MD5 保留原图
+	var originalStore *service.OriginalStore
+	if cfg.Retention.Enabled {
+		originalStore, err = service.NewOriginalStore(&cfg.Retention)
+		if err != nil {
+			utils.Logger.Fatal("failed to init original retention", zap.Error(err))
+		}
+		originalStore.StartCleanup(cfg.Retention.CleanupInterval)
+	}
 
 	// 初始化Handler
-	uploadHandler := handler.NewUploadHandler(cfg, redisService, grabCutService)
+	uploadHandler := handler.NewUploadHandler(cfg, redisService, grabCutService, imageFetcher, originalStore)
+	renderHandler := handler.NewRenderHandler(uploadHandler)
+	archiveHandler := handler.NewArchiveHandler(uploadHandler,
+		service.NewArchiveProcessor(grabCutService, redisService, &cfg.Archive, &cfg.Upload))
+	resumableHandler := handler.NewResumableHandler(uploadHandler, resumableStore)
+
+	// 异步任务，状态保存在 Redis 中，各实例共享同一队列
+	jobHandler := handler.NewJobHandler(uploadHandler, service.NewJobQueue(redisService, &cfg.Jobs))
+	jobHandler.StartWorkers(cfg.Jobs.Workers)
 
 	// 设置Gin模式
 	gin.SetMode(cfg.Server.Mode)
@@ -91,11 +129,46 @@ func main() {
 		})
 	})
 
+	// 请求体上限：文件大小上限加上其余表单字段和 multipart 边界的余量
+	// 背景合成可额外携带一张背景图；JSON 上传的 base64 编码使体积增加约 1/3
+	const formOverhead = 1 << 20
+	imageLimit := middleware.BodyLimit(cfg.Upload.MaxSize + formOverhead)
+	base64Limit := middleware.BodyLimit(cfg.Upload.MaxSize*4/3 + formOverhead)
+	batchLimit := middleware.BodyLimit(cfg.Upload.MaxBatchSize + formOverhead)
+	archiveLimit := middleware.BodyLimit(cfg.Archive.MaxSize + formOverhead)
+	compositeLimit := middleware.BodyLimit(2*cfg.Upload.MaxSize + formOverhead)
+
+	// 单图和批量接口在内存中流式读取表单并计算 MD5，不产生临时文件
+	memoryForm := uploadHandler.MemoryForm
+
 	// API路由
 	api := r.Group("/api/v1")
 	{
-		api.POST("/upload", uploadHandler.Upload)
+		api.POST("/upload", imageLimit, memoryForm, uploadHandler.Upload)
+		api.POST("/segment", base64Limit, uploadHandler.Segment)
+		api.POST("/batch", batchLimit, uploadHandler.BatchMemoryForm, uploadHandler.Batch)
+		api.POST("/archive", archiveLimit, archiveHandler.Archive)
+		api.POST("/sequence", archiveLimit, archiveHandler.Sequence)
 		api.GET("/layer/:md5", uploadHandler.GetByMD5)
+		api.POST("/jobs", imageLimit, memoryForm, jobHandler.Create)
+		api.GET("/jobs/:id", jobHandler.Get)
+		api.GET("/originals/:md5", uploadHandler.GetOriginal)
+
+		// tus 断点续传上传，分片请求体由 ResumableStore 按声明的长度限制
+		files := api.Group("/files", resumableHandler.Protocol)
+		files.OPTIONS("", resumableHandler.Options)
+		files.POST("", resumableHandler.Create)
+		files.HEAD("/:id", resumableHandler.Head)
+		files.PATCH("/:id", resumableHandler.Patch)
+		files.DELETE("/:id", resumableHandler.Delete)
+		files.GET("/:id", resumableHandler.Result)
+
+		api.GET("/layer/:md5/overlay.jpg", renderHandler.Overlay)
+		api.GET("/overlay/contact-sheet.jpg", renderHandler.ContactSheet)
+		api.POST("/composite", compositeLimit, memoryForm, renderHandler.Composite)
+		api.POST("/export/bokeh", imageLimit, memoryForm, renderHandler.Bokeh)
+		api.POST("/export/sticker", imageLimit, memoryForm, renderHandler.Sticker)
+		api.POST("/export/product", imageLimit, memoryForm, renderHandler.Product)
 	}
 
 	// 启动服务器
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimit 限制请求体大小
+// 声明的 Content-Length 超限时直接拒绝；否则用 http.MaxBytesReader 包装请求体，解析 multipart 时读到上限即失败
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, model.ErrorResponse{
+				Success: false,
+				Message: fmt.Sprintf("请求体超过限制 (%d MB)", limit/(1024*1024)),
+				Code:    model.ErrCodeFileTooLarge,
+			})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
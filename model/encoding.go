@@ -0,0 +1,264 @@
+package model
+
+import (
+	"encoding/base64"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// BinaryUploadResponse 二进制编码（MessagePack）使用的上传响应，掩码为原始 PNG 字节
+type BinaryUploadResponse struct {
+	Success bool               `json:"success"`
+	Message string             `json:"message"`
+	Data    *BinaryLayerResult `json:"data,omitempty"`
+}
+
+// BinaryLayerResult 二进制编码使用的分层结果
+type BinaryLayerResult struct {
+	SchemaVersion   int            `json:"schema_version"`
+	PipelineVersion int            `json:"pipeline_version"`
+	MD5             string         `json:"md5"`
+	Width           int            `json:"width"`
+	Height          int            `json:"height"`
+	Layers          []BinaryLayer  `json:"layers"`
+	Timestamp       int64          `json:"timestamp"`
+	Metadata        *ImageMetadata `json:"metadata,omitempty"`
+	Orientation     *Orientation   `json:"orientation,omitempty"`
+	AlphaPrior      string         `json:"alpha_prior"`
+	Complexity      string         `json:"complexity,omitempty"`
+	ColorConverted  bool           `json:"color_converted"`
+}
+
+// BinaryLayer 二进制编码使用的图层信息
+type BinaryLayer struct {
+	ID          int     `json:"id"`
+	Type        string  `json:"type"`
+	BoundingBox BBox    `json:"bounding_box"`
+	Mask        []byte  `json:"mask"` // PNG编码的mask数据
+	Confidence  float64 `json:"confidence"`
+	Shape       *Shape  `json:"shape,omitempty"`
+}
+
+// ToBinary 转换为掩码使用原始字节的结构
+func (r *UploadResponse) ToBinary() (*BinaryUploadResponse, error) {
+	resp := &BinaryUploadResponse{
+		Success: r.Success,
+		Message: r.Message,
+	}
+	if r.Data == nil {
+		return resp, nil
+	}
+
+	resp.Data = &BinaryLayerResult{
+		SchemaVersion:   r.Data.SchemaVersion,
+		PipelineVersion: r.Data.PipelineVersion,
+		MD5:             r.Data.MD5,
+		Width:           r.Data.Width,
+		Height:          r.Data.Height,
+		Timestamp:       r.Data.Timestamp,
+		Metadata:        r.Data.Metadata,
+		Orientation:     r.Data.Orientation,
+		AlphaPrior:      r.Data.AlphaPrior,
+		Complexity:      r.Data.Complexity,
+		ColorConverted:  r.Data.ColorConverted,
+		Layers:          make([]BinaryLayer, 0, len(r.Data.Layers)),
+	}
+	for _, l := range r.Data.Layers {
+		mask, err := base64.StdEncoding.DecodeString(l.Mask)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data.Layers = append(resp.Data.Layers, BinaryLayer{
+			ID:          l.ID,
+			Type:        l.Type,
+			BoundingBox: l.BoundingBox,
+			Mask:        mask,
+			Confidence:  l.Confidence,
+			Shape:       l.Shape,
+		})
+	}
+
+	return resp, nil
+}
+
+// MarshalProto 按 proto/layerkit.proto 中的 UploadResponse 定义编码为 Protobuf
+func (r *UploadResponse) MarshalProto() ([]byte, error) {
+	resp, err := r.ToBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendBool(b, 1, resp.Success)
+	b = appendString(b, 2, resp.Message)
+	if resp.Data != nil {
+		b = appendMessage(b, 3, resp.Data.marshalProto())
+	}
+	return b, nil
+}
+
+func (r *BinaryLayerResult) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, r.MD5)
+	b = appendInt(b, 2, int64(r.Width))
+	b = appendInt(b, 3, int64(r.Height))
+	for i := range r.Layers {
+		b = appendMessage(b, 4, r.Layers[i].marshalProto())
+	}
+	b = appendInt(b, 5, r.Timestamp)
+	b = appendInt(b, 6, int64(r.SchemaVersion))
+	b = appendInt(b, 7, int64(r.PipelineVersion))
+	if r.Metadata != nil {
+		b = appendMessage(b, 8, r.Metadata.marshalProto())
+	}
+	if r.Orientation != nil {
+		b = appendMessage(b, 9, r.Orientation.marshalProto())
+	}
+	b = appendString(b, 10, r.AlphaPrior)
+	b = appendString(b, 11, r.Complexity)
+	b = appendBool(b, 12, r.ColorConverted)
+	return b
+}
+
+func (l *BinaryLayer) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(l.ID))
+	b = appendString(b, 2, l.Type)
+	b = appendMessage(b, 3, l.BoundingBox.marshalProto())
+	b = appendBytes(b, 4, l.Mask)
+	b = appendDouble(b, 5, l.Confidence)
+	if l.Shape != nil {
+		b = appendMessage(b, 6, l.Shape.marshalProto())
+	}
+	return b
+}
+
+func (m *ImageMetadata) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Format)
+	b = appendInt(b, 2, m.FileSize)
+	b = appendInt(b, 3, int64(m.BitDepth))
+	b = appendInt(b, 4, int64(m.Channels))
+	b = appendInt(b, 5, int64(m.Orientation))
+	b = appendString(b, 6, m.ICCProfile)
+	b = appendString(b, 7, m.CameraMake)
+	b = appendString(b, 8, m.CameraModel)
+	b = appendString(b, 9, m.CaptureTime)
+	if m.GPS != nil {
+		var gps []byte
+		gps = appendDouble(gps, 1, m.GPS.Latitude)
+		gps = appendDouble(gps, 2, m.GPS.Longitude)
+		b = appendMessage(b, 10, gps)
+	}
+	b = appendString(b, 11, m.MD5)
+	b = appendString(b, 12, m.SHA256)
+	return b
+}
+
+func (o *Orientation) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(o.Exif))
+	b = appendString(b, 2, o.Transform)
+	b = appendString(b, 3, o.Output)
+	return b
+}
+
+func (bb BBox) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(bb.X))
+	b = appendInt(b, 2, int64(bb.Y))
+	b = appendInt(b, 3, int64(bb.Width))
+	b = appendInt(b, 4, int64(bb.Height))
+	return b
+}
+
+func (s *Shape) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(s.Area))
+	b = appendMessage(b, 2, s.Centroid.marshalProto())
+	b = appendMessage(b, 3, s.RotatedBox.marshalProto())
+	b = appendDouble(b, 4, s.Orientation)
+	for _, p := range s.ConvexHull {
+		b = appendMessage(b, 5, p.marshalProto())
+	}
+	b = appendDouble(b, 6, s.Solidity)
+	b = appendDouble(b, 7, s.Perimeter)
+	b = appendInt(b, 8, int64(s.Holes))
+	return b
+}
+
+func (r RotatedBox) marshalProto() []byte {
+	var b []byte
+	b = appendMessage(b, 1, r.Center.marshalProto())
+	b = appendDouble(b, 2, r.Width)
+	b = appendDouble(b, 3, r.Height)
+	b = appendDouble(b, 4, r.Angle)
+	for _, p := range r.Points {
+		b = appendMessage(b, 5, p.marshalProto())
+	}
+	return b
+}
+
+func (p Point) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(p.X))
+	b = appendInt(b, 2, int64(p.Y))
+	return b
+}
+
+func (p PointF) marshalProto() []byte {
+	var b []byte
+	b = appendDouble(b, 1, p.X)
+	b = appendDouble(b, 2, p.Y)
+	return b
+}
+
+// 以下辅助函数遵循 proto3 语义，标量字段为零值时不输出
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// appendInt 编码 int32/int64 字段，负数按补码写入
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendMessage 编码嵌套消息，空消息也会输出以表示字段已设置
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -0,0 +1,260 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fullResponse 返回所有字段均为非零值的上传响应，覆盖 proto/layerkit.proto 中的每个字段
+func fullResponse() *UploadResponse {
+	mask := base64.StdEncoding.EncodeToString([]byte("\x89PNG mask bytes"))
+	shape := &Shape{
+		Area:     1234,
+		Centroid: PointF{X: 10.5, Y: 20.25},
+		RotatedBox: RotatedBox{
+			Center: PointF{X: 11.5, Y: 21.5},
+			Width:  30.5,
+			Height: 40.5,
+			Angle:  -12.5,
+			Points: []PointF{{X: 1.5, Y: 2.5}, {X: 3.5, Y: 4.5}, {X: 5.5, Y: 6.5}, {X: 7.5, Y: 8.5}},
+		},
+		Orientation: 33.3,
+		ConvexHull:  []Point{{X: 1, Y: 2}, {X: 3, Y: 4}, {X: 5, Y: 6}},
+		Solidity:    0.87,
+		Perimeter:   456.75,
+		Holes:       2,
+	}
+	return &UploadResponse{
+		Success: true,
+		Message: "处理成功",
+		Data: &LayerResult{
+			SchemaVersion:   SchemaVersion,
+			PipelineVersion: 5,
+			MD5:             "0123456789abcdef0123456789abcdef",
+			Width:           640,
+			Height:          480,
+			Timestamp:       1699401234,
+			Metadata: &ImageMetadata{
+				Format:      "jpeg",
+				FileSize:    987654,
+				BitDepth:    8,
+				Channels:    3,
+				Orientation: 6,
+				ICCProfile:  "Display P3",
+				CameraMake:  "Canon",
+				CameraModel: "EOS R5",
+				CaptureTime: "2024:01:02 03:04:05",
+				GPS:         &GPS{Latitude: 31.2304, Longitude: -121.4737},
+				MD5:         "0123456789abcdef0123456789abcdef",
+				SHA256:      strings.Repeat("ab", 32),
+			},
+			Orientation: &Orientation{
+				Exif:      6,
+				Transform: "rotate_90_cw",
+				Output:    "upright",
+			},
+			AlphaPrior:     "seed",
+			Complexity:     "portrait",
+			ColorConverted: true,
+			Layers: []Layer{
+				{
+					ID:          1,
+					Type:        "foreground",
+					BoundingBox: BBox{X: 5, Y: 6, Width: 100, Height: 200},
+					Mask:        mask,
+					Confidence:  0.93,
+					Shape:       shape,
+				},
+				{
+					ID:          2,
+					Type:        "background",
+					BoundingBox: BBox{X: 1, Y: 2, Width: 640, Height: 480},
+					Mask:        mask,
+					Confidence:  0.07,
+					Shape:       shape,
+				},
+			},
+		},
+	}
+}
+
+// TestMarshalProtoRoundTrip 以 proto/layerkit.proto 构建动态消息解码 MarshalProto 的输出，
+// 逐字段与 JSON 编码对比，字段编号、类型或名称与 .proto 不一致时失败
+func TestMarshalProtoRoundTrip(t *testing.T) {
+	desc := loadProtoMessage(t, "../proto/layerkit.proto", "UploadResponse")
+
+	resp := fullResponse()
+	data, err := resp.MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto: %v", err)
+	}
+
+	msg := dynamicpb.NewMessage(desc)
+	if err := (proto.UnmarshalOptions{DiscardUnknown: false}).Unmarshal(data, msg); err != nil {
+		t.Fatalf("unmarshal with layerkit.proto: %v", err)
+	}
+	checkFullyPopulated(t, msg, "UploadResponse")
+
+	got := protoToMap(msg)
+
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	if err := json.Unmarshal(encoded, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("protobuf and JSON encodings differ\nprotobuf: %s\njson: %s", gotJSON, wantJSON)
+	}
+}
+
+// checkFullyPopulated 确认测试数据设置了 .proto 中的每个字段，且没有 .proto 中不存在的字段编号
+func checkFullyPopulated(t *testing.T, msg protoreflect.Message, path string) {
+	t.Helper()
+	if unknown := msg.GetUnknown(); len(unknown) > 0 {
+		t.Errorf("%s: %d bytes of fields not declared in layerkit.proto", path, len(unknown))
+	}
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := path + "." + string(fd.Name())
+		if !msg.Has(fd) {
+			t.Errorf("%s: not set by MarshalProto", name)
+			continue
+		}
+		switch {
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			list := msg.Get(fd).List()
+			for j := 0; j < list.Len(); j++ {
+				checkFullyPopulated(t, list.Get(j).Message(), name+"["+strconv.Itoa(j)+"]")
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			checkFullyPopulated(t, msg.Get(fd).Message(), name)
+		}
+	}
+}
+
+// protoToMap 将动态消息转换为与 encoding/json 解码结果相同形式的 map，bytes 按 Base64 编码
+func protoToMap(msg protoreflect.Message) map[string]any {
+	out := map[string]any{}
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsList() {
+			list := v.List()
+			items := make([]any, 0, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				items = append(items, protoValue(fd, list.Get(i)))
+			}
+			out[string(fd.Name())] = items
+		} else {
+			out[string(fd.Name())] = protoValue(fd, v)
+		}
+		return true
+	})
+	return out
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.Int32Kind, protoreflect.Int64Kind:
+		return float64(v.Int())
+	case protoreflect.DoubleKind:
+		return v.Float()
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	case protoreflect.MessageKind:
+		return protoToMap(v.Message())
+	default:
+		panic("unsupported kind " + fd.Kind().String())
+	}
+}
+
+var (
+	protoComment = regexp.MustCompile(`//[^\n]*`)
+	protoPackage = regexp.MustCompile(`package\s+([\w.]+)\s*;`)
+	protoMessage = regexp.MustCompile(`message\s+(\w+)\s*\{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(repeated\s+)?(\w+)\s+(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"int32":  descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+// loadProtoMessage 解析 .proto 文件并返回指定消息的描述符
+// 只支持 layerkit.proto 用到的语法：proto3、单层 message、标量/消息/repeated 字段
+func loadProtoMessage(t *testing.T, path, name string) protoreflect.MessageDescriptor {
+	t.Helper()
+	src, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := protoComment.ReplaceAllString(string(src), "")
+
+	pkg := protoPackage.FindStringSubmatch(text)
+	if pkg == nil {
+		t.Fatalf("%s: package not found", path)
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("layerkit.proto"),
+		Package: proto.String(pkg[1]),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, m := range protoMessage.FindAllStringSubmatch(text, -1) {
+		msg := &descriptorpb.DescriptorProto{Name: proto.String(m[1])}
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			number, _ := strconv.Atoi(f[4])
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(f[3]),
+				JsonName: proto.String(f[3]),
+				Number:   proto.Int32(int32(number)),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if f[1] != "" {
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			if typ, ok := protoScalars[f[2]]; ok {
+				field.Type = typ.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + pkg[1] + "." + f[2])
+			}
+			msg.Field = append(msg.Field, field)
+		}
+		file.MessageType = append(file.MessageType, msg)
+	}
+
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	desc := fd.Messages().ByName(protoreflect.Name(name))
+	if desc == nil {
+		t.Fatalf("%s: message %s not found", path, name)
+	}
+	return desc
+}
@@ -1,12 +1,52 @@
 package model
 
+// SchemaVersion 当前 LayerResult 的结构版本
+// 字段的新增、删除或语义变化都需要递增；未同时递增管线版本时，需在 service 中补充对应的缓存迁移
+const SchemaVersion = 7
+
 // LayerResult 分层结果
 type LayerResult struct {
-	MD5       string  `json:"md5"`
-	Width     int     `json:"width"`
-	Height    int     `json:"height"`
-	Layers    []Layer `json:"layers"`
-	Timestamp int64   `json:"timestamp"`
+	SchemaVersion   int            `json:"schema_version"`   // 结构版本，缺失时视为 1
+	PipelineVersion int            `json:"pipeline_version"` // 生成结果的处理管线版本
+	MD5             string         `json:"md5"`
+	Width           int            `json:"width"`
+	Height          int            `json:"height"`
+	Layers          []Layer        `json:"layers"`
+	Timestamp       int64          `json:"timestamp"`
+	Metadata        *ImageMetadata `json:"metadata,omitempty"`    // 原图元数据
+	Orientation     *Orientation   `json:"orientation,omitempty"` // 处理时应用的方向变换，Width/Height 及掩码均在 Output 方向下
+	AlphaPrior      string         `json:"alpha_prior"`           // 透明通道的使用方式：none、cutout、seed 或 ignored
+	Complexity      string         `json:"complexity,omitempty"`  // 场景复杂度：simple、medium、complex 或 portrait，透明通道直接作为掩码时为空
+	ColorConverted  bool           `json:"color_converted"`       // 分析前是否按嵌入的 ICC 配置文件将像素转换为 sRGB
+}
+
+// Orientation 原图的 EXIF 方向及处理时应用的变换
+type Orientation struct {
+	Exif      int    `json:"exif"`      // EXIF Orientation（1-8），无标签时为 1
+	Transform string `json:"transform"` // 转正所需的像素变换，如 rotate_90_cw
+	Output    string `json:"output"`    // 掩码所在的方向：upright（转正后）或 stored（存储方向）
+}
+
+// ImageMetadata 原图格式、元数据和哈希
+type ImageMetadata struct {
+	Format      string `json:"format"`                 // jpeg, png, webp, gif, bmp, tiff
+	FileSize    int64  `json:"file_size"`              // 文件大小（字节）
+	BitDepth    int    `json:"bit_depth"`              // 每通道位深
+	Channels    int    `json:"channels"`               // 通道数
+	Orientation int    `json:"orientation,omitempty"`  // EXIF 方向（1-8）
+	ICCProfile  string `json:"icc_profile,omitempty"`  // 嵌入的 ICC 配置文件名称
+	CameraMake  string `json:"camera_make,omitempty"`  // 相机厂商
+	CameraModel string `json:"camera_model,omitempty"` // 相机型号
+	CaptureTime string `json:"capture_time,omitempty"` // 拍摄时间（EXIF 原始格式）
+	GPS         *GPS   `json:"gps,omitempty"`          // 拍摄位置，默认不返回
+	MD5         string `json:"md5"`
+	SHA256      string `json:"sha256"`
+}
+
+// GPS 拍摄位置
+type GPS struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
 // Layer 单个图层信息
@@ -16,6 +56,7 @@ type Layer struct {
 	BoundingBox BBox    `json:"bounding_box"`
 	Mask        string  `json:"mask"` // base64编码的mask数据
 	Confidence  float64 `json:"confidence"`
+	Shape       *Shape  `json:"shape,omitempty"` // 形状描述，按需计算
 }
 
 // BBox 边界框
@@ -26,6 +67,39 @@ type BBox struct {
 	Height int `json:"height"`
 }
 
+// Shape 基于掩码计算的形状描述
+type Shape struct {
+	Area        int        `json:"area"`        // 面积（像素）
+	Centroid    PointF     `json:"centroid"`    // 质心
+	RotatedBox  RotatedBox `json:"rotated_box"` // 最小外接旋转矩形
+	Orientation float64    `json:"orientation"` // 主轴方向（角度，相对水平方向，顺时针为正）
+	ConvexHull  []Point    `json:"convex_hull"` // 凸包顶点
+	Solidity    float64    `json:"solidity"`    // 面积与凸包面积之比
+	Perimeter   float64    `json:"perimeter"`   // 外轮廓周长（像素）
+	Holes       int        `json:"holes"`       // 内部孔洞数量
+}
+
+// RotatedBox 旋转矩形
+type RotatedBox struct {
+	Center PointF   `json:"center"`
+	Width  float64  `json:"width"`
+	Height float64  `json:"height"`
+	Angle  float64  `json:"angle"`  // 旋转角度（角度）
+	Points []PointF `json:"points"` // 四个顶点
+}
+
+// Point 整数坐标点
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// PointF 浮点坐标点
+type PointF struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
 // UploadResponse 上传响应
 type UploadResponse struct {
 	Success bool         `json:"success"`
@@ -33,9 +107,109 @@ type UploadResponse struct {
 	Data    *LayerResult `json:"data,omitempty"`
 }
 
+// SegmentRequest JSON 上传请求，image_base64 与 image_url 二选一
+type SegmentRequest struct {
+	ImageBase64       string `json:"image_base64" binding:"required_without=ImageURL,excluded_with=ImageURL"` // base64 编码的图片，可带 data URI 前缀
+	ImageURL          string `json:"image_url" binding:"omitempty,url"`                                       // 远程图片地址，拉取规则与表单上传相同
+	MaxForegroundOnly bool   `json:"max_foreground_only"`
+	ShapeDescriptors  bool   `json:"shape_descriptors"`
+	Orientation       string `json:"orientation" binding:"omitempty,oneof=upright stored"` // 为空时使用配置
+}
+
+// SequenceResult 动图或帧序列的逐帧分层结果，所有帧尺寸相同
+type SequenceResult struct {
+	PipelineVersion int             `json:"pipeline_version"`
+	MD5             string          `json:"md5"`
+	Width           int             `json:"width"`
+	Height          int             `json:"height"`
+	Frames          []SequenceFrame `json:"frames"`
+	Timestamp       int64           `json:"timestamp"`
+}
+
+// SequenceFrame 单帧的分层结果
+type SequenceFrame struct {
+	Index  int     `json:"index"`
+	Delay  int     `json:"delay"`  // 显示时长（毫秒）
+	Seeded bool    `json:"seeded"` // 是否以上一帧掩码初始化；首帧和镜头切换后的帧为 false
+	Layers []Layer `json:"layers"`
+}
+
+// SequenceResponse 序列分层响应
+type SequenceResponse struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    *SequenceResult `json:"data,omitempty"`
+}
+
+// BatchItem 批量上传中单张图片的结果，失败时 Status、Code、Message 说明原因
+type BatchItem struct {
+	Index   int          `json:"index"`
+	Source  string       `json:"source"` // 文件名或 URL
+	Success bool         `json:"success"`
+	Cached  bool         `json:"cached,omitempty"`
+	MD5     string       `json:"md5,omitempty"`
+	Data    *LayerResult `json:"data,omitempty"`
+	Status  int          `json:"status,omitempty"` // 失败时对应单图接口的 HTTP 状态码
+	Code    string       `json:"code,omitempty"`
+	Message string       `json:"message,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// BatchResponse 批量上传响应，条目顺序与请求中的文件和 URL 顺序一致（先文件后 URL）
+type BatchResponse struct {
+	Success   bool        `json:"success"`
+	Message   string      `json:"message"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Items     []BatchItem `json:"items"`
+}
+
+// 异步任务状态
+const (
+	JobQueued  = "queued"  // 排队中
+	JobRunning = "running" // 处理中
+	JobDone    = "done"    // 已完成，Result 为分层结果
+	JobFailed  = "failed"  // 失败，Error 为与同步接口相同的错误响应
+)
+
+// Job 异步分层任务
+type Job struct {
+	ID            string         `json:"id"`
+	Status        string         `json:"status"`                   // queued、running、done 或 failed
+	QueuePosition int            `json:"queue_position,omitempty"` // 排队中时在全局队列中的位置，1 表示下一个执行
+	MD5           string         `json:"md5"`
+	CreatedAt     int64          `json:"created_at"`
+	StartedAt     int64          `json:"started_at,omitempty"`
+	FinishedAt    int64          `json:"finished_at,omitempty"`
+	Cached        bool           `json:"cached,omitempty"`
+	Result        *LayerResult   `json:"result,omitempty"`
+	Error         *ErrorResponse `json:"error,omitempty"`
+}
+
+// JobResponse 异步任务的提交和查询响应
+type JobResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Data    *Job   `json:"data,omitempty"`
+}
+
 // ErrorResponse 错误响应
 type ErrorResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
+	Code    string `json:"code,omitempty"` // 机器可读的错误码，见 ErrCode* 常量
 	Error   string `json:"error,omitempty"`
 }
+
+// 上传被拒绝时的错误码
+const (
+	ErrCodeMissingFile      = "missing_file"       // 缺少图片文件字段
+	ErrCodeFileTooLarge     = "file_too_large"     // 文件或请求体超过大小限制
+	ErrCodeImageTooLarge    = "image_too_large"    // 图片宽、高或总像素超过像素限制
+	ErrCodeUnsupportedType  = "unsupported_type"   // 文件内容不是受支持的图片格式
+	ErrCodeURLNotAllowed    = "url_not_allowed"    // image_url 的协议、主机或解析地址不被允许
+	ErrCodeFetchFailed      = "fetch_failed"       // 拉取 image_url 失败
+	ErrCodeInvalidRequest   = "invalid_request"    // JSON 请求体格式或字段校验失败
+	ErrCodeOriginalNotFound = "original_not_found" // 未保留该 MD5 的原图（未开启保留、已过期或已被淘汰）
+	ErrCodeQueueFull        = "queue_full"         // 异步任务排队数达到上限，或渲染等待处理名额超时
+)
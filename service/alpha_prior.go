@@ -0,0 +1,141 @@
+package service
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// 透明通道作为分割先验的使用方式，记录在 LayerResult.AlphaPrior 中
+const (
+	AlphaPriorNone    = "none"    // 没有透明通道，或没有完全透明的像素
+	AlphaPriorCutout  = "cutout"  // 已抠好的图，透明通道直接作为前景掩码，跳过 GrabCut
+	AlphaPriorSeed    = "seed"    // 完全透明的像素作为确定背景初始化 GrabCut
+	AlphaPriorIgnored = "ignored" // 有透明通道，但配置为忽略
+)
+
+// GrabCut 掩码标签
+const (
+	gcBackground         = 0 // 确定背景
+	gcForeground         = 1 // 确定前景
+	gcProbableBackground = 2 // 可能背景
+	gcProbableForeground = 3 // 可能前景
+)
+
+// alphaStats 透明通道的像素统计
+type alphaStats struct {
+	transparent int             // alpha 为 0 的像素数
+	visible     int             // alpha 大于 0 的像素数
+	bounds      image.Rectangle // 可见像素的边界框
+}
+
+// loadAlphaPrior 读取透明通道并按配置决定使用方式
+// 返回的 alpha 已转正；使用方式不是 cutout 或 seed 时为空 Mat
+func (s *GrabCutService) loadAlphaPrior(data []byte, orientation int) (gocv.Mat, string) {
+	alpha, ok := decodeAlpha(data)
+	if !ok {
+		return gocv.NewMat(), AlphaPriorNone
+	}
+
+	stats, err := measureAlpha(&alpha)
+	if err != nil || stats.transparent == 0 || stats.visible == 0 {
+		alpha.Close()
+		return gocv.NewMat(), AlphaPriorNone
+	}
+
+	var prior string
+	switch s.alphaPrior {
+	case "ignore":
+		prior = AlphaPriorIgnored
+	case AlphaPriorCutout, AlphaPriorSeed:
+		prior = s.alphaPrior
+	default:
+		// 可见区域接近矩形说明只是透明留边，其中仍包含背景，需要分割；否则视为已抠好的主体
+		if float64(stats.visible) >= 0.98*float64(stats.bounds.Dx()*stats.bounds.Dy()) {
+			prior = AlphaPriorSeed
+		} else {
+			prior = AlphaPriorCutout
+		}
+	}
+
+	if prior == AlphaPriorIgnored {
+		alpha.Close()
+		return gocv.NewMat(), prior
+	}
+
+	orientUpright(&alpha, orientation)
+	return alpha, prior
+}
+
+// measureAlpha 统计透明和可见像素数及可见区域的边界框
+func measureAlpha(alpha *gocv.Mat) (alphaStats, error) {
+	data, err := alpha.DataPtrUint8()
+	if err != nil {
+		return alphaStats{}, err
+	}
+
+	width, height := alpha.Cols(), alpha.Rows()
+	stats := alphaStats{}
+	minX, minY, maxX, maxY := width, height, -1, -1
+	for y := 0; y < height; y++ {
+		row := data[y*width : (y+1)*width]
+		for x, a := range row {
+			if a == 0 {
+				stats.transparent++
+				continue
+			}
+			stats.visible++
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+	if stats.visible > 0 {
+		stats.bounds = image.Rect(minX, minY, maxX+1, maxY+1)
+	}
+
+	return stats, nil
+}
+
+// seedWithAlpha 将完全透明的像素标记为 GrabCut 确定背景
+// mask 为空时按 rect 初始化（与 GCInitWithRect 一致：矩形内可能前景，矩形外确定背景）
+// 返回收缩到可见区域后的初始矩形
+func seedWithAlpha(mask, alpha *gocv.Mat, rect image.Rectangle, size image.Point) image.Rectangle {
+	scaled := gocv.NewMat()
+	defer scaled.Close()
+	gocv.Resize(*alpha, &scaled, size, 0, 0, gocv.InterpolationNearestNeighbor)
+
+	stats, err := measureAlpha(&scaled)
+	if err != nil || stats.visible == 0 {
+		return rect
+	}
+	if tightened := rect.Intersect(stats.bounds); !tightened.Empty() {
+		rect = tightened
+	} else {
+		rect = stats.bounds
+	}
+
+	if mask.Empty() {
+		mask.Close()
+		*mask = gocv.NewMatWithSize(size.Y, size.X, gocv.MatTypeCV8U)
+		mask.SetTo(gocv.NewScalar(gcBackground, 0, 0, 0))
+		region := mask.Region(rect)
+		region.SetTo(gocv.NewScalar(gcProbableForeground, 0, 0, 0))
+		region.Close()
+	}
+
+	maskData, err := mask.DataPtrUint8()
+	if err != nil {
+		return rect
+	}
+	alphaData, err := scaled.DataPtrUint8()
+	if err != nil {
+		return rect
+	}
+	for i, a := range alphaData {
+		if a == 0 {
+			maskData[i] = gcBackground
+		}
+	}
+
+	return rect
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/utils"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+)
+
+var ErrArchiveTooLarge = errors.New("archive exceeds limits")
+
+// ArchiveEntry ZIP 中单个文件的处理结果，写入输出包的 summary.json 和 summary.csv
+type ArchiveEntry struct {
+	Path       string  `json:"path"`
+	MD5        string  `json:"md5,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Complexity string  `json:"complexity,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	Mask       string  `json:"mask,omitempty"`   // 输出包中掩码的路径
+	Cutout     string  `json:"cutout,omitempty"` // 输出包中透明抠图的路径
+	Error      string  `json:"error,omitempty"`
+}
+
+// ArchiveSummary 整个 ZIP 的处理汇总，条目顺序与输入包一致
+type ArchiveSummary struct {
+	Processed int            `json:"processed"`
+	Failed    int            `json:"failed"`
+	Entries   []ArchiveEntry `json:"entries"`
+}
+
+// ArchiveProcessor 处理 ZIP 图片包：逐个分层，输出目录结构与输入一致的掩码和抠图包
+// 条目内容只在内存中处理，不写入磁盘
+type ArchiveProcessor struct {
+	grabCut      *GrabCutService
+	cache        *RedisService // 可为 nil（如命令行模式）
+	limits       config.ArchiveConfig
+	maxEntrySize int64
+	allowedTypes []string
+}
+
+func NewArchiveProcessor(grabCut *GrabCutService, cache *RedisService, cfg *config.ArchiveConfig, uploadCfg *config.UploadConfig) *ArchiveProcessor {
+	return &ArchiveProcessor{
+		grabCut:      grabCut,
+		cache:        cache,
+		limits:       *cfg,
+		maxEntrySize: uploadCfg.MaxSize,
+		allowedTypes: uploadCfg.AllowedTypes,
+	}
+}
+
+// Inspect 按中央目录检查 ZIP 是否超出条目数、单条大小、总大小和压缩比限制，返回需要处理的文件条目
+// 中央目录中的大小可以伪造，处理时还会按实际解压字节数再次限制
+func (p *ArchiveProcessor) Inspect(r *zip.Reader) ([]*zip.File, error) {
+	var files []*zip.File
+	var total uint64
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || isArchiveJunk(f.Name) {
+			continue
+		}
+		files = append(files, f)
+
+		if len(files) > p.limits.MaxEntries {
+			return nil, fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, p.limits.MaxEntries)
+		}
+		if f.UncompressedSize64 > uint64(p.maxEntrySize) {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrArchiveTooLarge, f.Name, p.maxEntrySize)
+		}
+		if f.UncompressedSize64 > f.CompressedSize64*uint64(p.limits.MaxRatio) {
+			return nil, fmt.Errorf("%w: %s has compression ratio above %d", ErrArchiveTooLarge, f.Name, p.limits.MaxRatio)
+		}
+		total += f.UncompressedSize64
+		if total > uint64(p.limits.MaxTotalSize) {
+			return nil, fmt.Errorf("%w: uncompressed size exceeds %d bytes", ErrArchiveTooLarge, p.limits.MaxTotalSize)
+		}
+	}
+	return files, nil
+}
+
+// Process 处理 ZIP 中的图片并将结果包写入 w
+// 每张图片 dir/name.ext 输出 dir/name.mask.png（前景掩码）和 dir/name.cutout.png（透明抠图），
+// 根目录附带 summary.json 和 summary.csv；单个文件失败只记录在汇总中
+// 返回错误时可能已向 w 写入部分数据，调用方应先通过 Inspect 检查
+func (p *ArchiveProcessor) Process(ctx context.Context, r *zip.Reader, w io.Writer, opts ProcessOptions) (*ArchiveSummary, error) {
+	files, err := p.Inspect(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// 抠图基于转正后的原图，掩码也需要是转正后的方向
+	opts.StoredOrientation = false
+
+	zw := zip.NewWriter(w)
+	var zmu sync.Mutex
+	var writeErr error
+	write := func(name string, data []byte) {
+		zmu.Lock()
+		defer zmu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		method := zip.Deflate
+		if strings.HasSuffix(name, ".png") {
+			method = zip.Store // PNG 已压缩
+		}
+		out, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err == nil {
+			_, err = out.Write(data)
+		}
+		writeErr = err
+	}
+
+	// 预先确定输出路径：同一目录下仅扩展名不同的文件（如 a.jpg 和 a.png）保留原扩展名以免重名
+	items := make([]archiveItem, len(files))
+	used := make(map[string]bool)
+	for i, f := range files {
+		items[i].file = f
+		name, ok := safeArchivePath(f.Name)
+		if !ok {
+			continue
+		}
+		items[i].path = name
+		items[i].base = strings.TrimSuffix(name, path.Ext(name))
+		if used[items[i].base] {
+			items[i].base = name
+		}
+		used[items[i].base] = true
+	}
+
+	entries := make([]ArchiveEntry, len(files))
+	var remaining int64 = p.limits.MaxTotalSize
+	var budgetMu sync.Mutex
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, min(cap(p.grabCut.semaphore), len(files))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entries[i] = p.processEntry(ctx, items[i], opts, &remaining, &budgetMu, write)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	summary := &ArchiveSummary{Entries: entries}
+	for _, entry := range entries {
+		if entry.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Processed++
+		}
+	}
+
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	write("summary.json", summaryJSON)
+	write("summary.csv", summary.csv())
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// ReadFrames 读取 ZIP 中的帧图片，按文件名中的数字顺序排列（frame_2.png 在 frame_10.png 之前）
+// 解压限制与 Process 相同，任一条目路径不安全或不是受支持的图片时返回 ErrInvalidParam
+func (p *ArchiveProcessor) ReadFrames(r *zip.Reader, maxFrames int) ([][]byte, error) {
+	files, err := p.Inspect(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: archive has no frames", ErrInvalidParam)
+	}
+	if len(files) > maxFrames {
+		return nil, fmt.Errorf("%w: archive has %d frames, at most %d allowed", ErrInvalidParam, len(files), maxFrames)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return naturalLess(files[i].Name, files[j].Name)
+	})
+
+	remaining := p.limits.MaxTotalSize
+	var budgetMu sync.Mutex
+	frames := make([][]byte, 0, len(files))
+	for _, f := range files {
+		if _, ok := safeArchivePath(f.Name); !ok {
+			return nil, fmt.Errorf("%w: unsafe path %q", ErrInvalidParam, f.Name)
+		}
+		data, err := p.readEntry(f, &remaining, &budgetMu)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrArchiveTooLarge, f.Name, err)
+		}
+		imageType, ok := DetectImageType(data)
+		if !ok || !containsFold(p.allowedTypes, imageType.ContentType) {
+			return nil, fmt.Errorf("%w: %s is not a supported image", ErrInvalidParam, f.Name)
+		}
+		frames = append(frames, data)
+	}
+
+	return frames, nil
+}
+
+// naturalLess 按自然顺序比较文件名，连续数字按数值比较
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// archiveItem 待处理的条目及其在输出包中的路径前缀，path 为空表示路径不安全
+type archiveItem struct {
+	file *zip.File
+	path string
+	base string
+}
+
+// processEntry 解压并处理单个条目，remaining 为剩余的解压字节预算
+func (p *ArchiveProcessor) processEntry(ctx context.Context, item archiveItem, opts ProcessOptions, remaining *int64, budgetMu *sync.Mutex, write func(string, []byte)) ArchiveEntry {
+	if item.path == "" {
+		return ArchiveEntry{Path: item.file.Name, Error: "unsafe path"}
+	}
+	entry := ArchiveEntry{Path: item.path}
+
+	data, err := p.readEntry(item.file, remaining, budgetMu)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	imageType, ok := DetectImageType(data)
+	if !ok || !containsFold(p.allowedTypes, imageType.ContentType) {
+		entry.Error = "unsupported file type"
+		return entry
+	}
+
+	md5 := utils.BytesMD5(data)
+	entry.MD5 = md5
+
+	result, err := p.layers(ctx, data, md5, opts)
+	if err != nil {
+		utils.Logger.Warn("failed to process archive entry",
+			zap.String("path", item.path),
+			zap.Error(err))
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Width, entry.Height, entry.Complexity = result.Width, result.Height, result.Complexity
+	fg, err := foregroundLayer(result)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.Confidence = fg.Confidence
+
+	maskPNG, err := base64.StdEncoding.DecodeString(fg.Mask)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	cutout, err := renderCutout(data, fg.Mask)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Mask, entry.Cutout = item.base+".mask.png", item.base+".cutout.png"
+	write(entry.Mask, maskPNG)
+	write(entry.Cutout, cutout)
+
+	return entry
+}
+
+// readEntry 读取条目内容，按实际解压字节数限制单条大小和剩余总量
+func (p *ArchiveProcessor) readEntry(f *zip.File, remaining *int64, budgetMu *sync.Mutex) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, p.maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > p.maxEntrySize {
+		return nil, fmt.Errorf("file larger than %d bytes", p.maxEntrySize)
+	}
+
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+	if int64(len(data)) > *remaining {
+		return nil, fmt.Errorf("archive uncompressed size exceeds %d bytes", p.limits.MaxTotalSize)
+	}
+	*remaining -= int64(len(data))
+
+	return data, nil
+}
+
+// layers 获取分层结果，优先读取缓存，未命中时在内存中处理
+func (p *ArchiveProcessor) layers(ctx context.Context, data []byte, md5 string, opts ProcessOptions) (*model.LayerResult, error) {
+	cacheKey := opts.CacheKey(md5)
+	if p.cache != nil {
+		if result, err := p.cache.GetLayerResult(ctx, cacheKey); err == nil && result != nil {
+			return result, nil
+		}
+	}
+
+	result, err := p.grabCut.ProcessImageData(data, md5, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.cache != nil {
+		if err := p.cache.SetLayerResult(ctx, cacheKey, result); err != nil {
+			utils.Logger.Warn("failed to set cache", zap.Error(err))
+		}
+	}
+	return result, nil
+}
+
+// renderCutout 以前景掩码为 alpha 通道生成透明 PNG
+func renderCutout(data []byte, encodedMask string) ([]byte, error) {
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, err
+	}
+	defer img.Close()
+
+	mask, err := decodeMask(encodedMask, img.Cols(), img.Rows())
+	if err != nil {
+		return nil, err
+	}
+	defer mask.Close()
+
+	channels := gocv.Split(img)
+	channels = append(channels, mask)
+	defer func() {
+		for _, ch := range channels[:3] {
+			ch.Close()
+		}
+	}()
+
+	bgra := gocv.NewMat()
+	defer bgra.Close()
+	gocv.Merge(channels, &bgra)
+
+	out, _, err := encodeImage(&bgra, "png")
+	return out, err
+}
+
+// csv 将汇总编码为 CSV，每个文件一行
+func (s *ArchiveSummary) csv() []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"path", "md5", "width", "height", "complexity", "confidence", "mask", "cutout", "error"})
+	for _, e := range s.Entries {
+		w.Write([]string{
+			e.Path,
+			e.MD5,
+			strconv.Itoa(e.Width),
+			strconv.Itoa(e.Height),
+			e.Complexity,
+			strconv.FormatFloat(e.Confidence, 'f', 4, 64),
+			e.Mask,
+			e.Cutout,
+			e.Error,
+		})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// safeArchivePath 规范化条目路径，拒绝绝对路径、盘符和跳出根目录的路径（zip-slip）
+// 输出包沿用规范化后的路径，解压输出包时同样不会越界
+func safeArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return "", false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+	cleaned := path.Clean(name)
+	return cleaned, cleaned != "."
+}
+
+// isArchiveJunk 判断是否为 macOS 资源分支、隐藏文件等无需处理也无需报告的条目
+func isArchiveJunk(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	base := path.Base(name)
+	return strings.HasPrefix(base, ".") || strings.EqualFold(base, "Thumbs.db")
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// bokehLevels 预计算的模糊层级数量，层级越多过渡越平滑
+const bokehLevels = 5
+
+// BokehSpec 人像虚化参数
+type BokehSpec struct {
+	Radius  int    // 最大模糊半径（像素）
+	Falloff int    // 距主体多远（像素）达到最大模糊，0 表示按图像尺寸自动计算
+	Feather int    // 主体边缘羽化半径（像素）
+	Format  string // 输出格式：png, jpg, webp
+}
+
+// BokehRenderer 基于前景掩码生成景深虚化效果
+type BokehRenderer struct {
+	maskProcessor *MaskProcessor
+}
+
+func NewBokehRenderer() *BokehRenderer {
+	return &BokehRenderer{
+		maskProcessor: NewMaskProcessor(),
+	}
+}
+
+// Render 按与主体的距离逐渐加强背景模糊，并将清晰的主体叠加回原位置
+func (br *BokehRenderer) Render(imageData []byte, result *model.LayerResult, spec BokehSpec) ([]byte, string, error) {
+	if spec.Radius <= 0 || spec.Radius > 100 {
+		return nil, "", fmt.Errorf("%w: radius must be in [1, 100]", ErrInvalidParam)
+	}
+	if spec.Falloff < 0 {
+		return nil, "", fmt.Errorf("%w: falloff must be >= 0", ErrInvalidParam)
+	}
+	if spec.Feather > 100 {
+		return nil, "", fmt.Errorf("%w: feather must be <= 100", ErrInvalidParam)
+	}
+
+	img, err := decodeImage(imageData)
+	if err != nil {
+		return nil, "", err
+	}
+	defer img.Close()
+
+	layer, err := foregroundLayer(result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mask, err := decodeMask(layer.Mask, img.Cols(), img.Rows())
+	if err != nil {
+		return nil, "", err
+	}
+	defer mask.Close()
+
+	falloff := spec.Falloff
+	if falloff == 0 {
+		falloff = max(1, int(float64(max(img.Cols(), img.Rows()))*0.15))
+	}
+
+	levels := br.blurLevels(&img, &mask, spec.Radius)
+	defer func() {
+		for i := range levels {
+			levels[i].Close()
+		}
+	}()
+
+	canvas, err := br.blendByDistance(&img, &mask, levels, falloff)
+	if err != nil {
+		return nil, "", err
+	}
+	defer canvas.Close()
+
+	alpha := br.maskProcessor.Feather(&mask, spec.Feather)
+	defer alpha.Close()
+	alphaBlend(&canvas, &img, &alpha, image.Point{})
+
+	return encodeImage(&canvas, spec.Format)
+}
+
+// blurLevels 生成从弱到强的背景模糊层级
+// 使用归一化卷积（只累加背景像素再除以背景权重），避免前景颜色渗入模糊后的背景形成光晕
+func (br *BokehRenderer) blurLevels(img, mask *gocv.Mat, radius int) []gocv.Mat {
+	// 略微外扩前景，排除边缘处混有前景颜色的像素
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Point{X: 5, Y: 5})
+	defer kernel.Close()
+	dilated := gocv.NewMat()
+	defer dilated.Close()
+	gocv.Dilate(*mask, &dilated, kernel)
+
+	weight := gocv.NewMat()
+	defer weight.Close()
+	gocv.BitwiseNot(dilated, &weight)
+	weight.ConvertToWithParams(&weight, gocv.MatTypeCV32F, 1.0/255, 0)
+
+	weight3 := gocv.NewMat()
+	defer weight3.Close()
+	gocv.Merge([]gocv.Mat{weight, weight, weight}, &weight3)
+
+	imgF := gocv.NewMat()
+	defer imgF.Close()
+	img.ConvertTo(&imgF, gocv.MatTypeCV32FC3)
+
+	premultiplied := gocv.NewMat()
+	defer premultiplied.Close()
+	gocv.Multiply(imgF, weight3, &premultiplied)
+
+	levels := make([]gocv.Mat, 0, bokehLevels)
+	for k := 1; k <= bokehLevels; k++ {
+		r := max(1, radius*k/bokehLevels)
+		ksize := image.Point{X: r*2 + 1, Y: r*2 + 1}
+
+		blurredColor := gocv.NewMat()
+		gocv.GaussianBlur(premultiplied, &blurredColor, ksize, 0, 0, gocv.BorderReflect101)
+
+		blurredWeight := gocv.NewMat()
+		gocv.GaussianBlur(weight3, &blurredWeight, ksize, 0, 0, gocv.BorderReflect101)
+		blurredWeight.AddFloat(1e-4)
+
+		normalized := gocv.NewMat()
+		gocv.Divide(blurredColor, blurredWeight, &normalized)
+		blurredColor.Close()
+		blurredWeight.Close()
+
+		level := gocv.NewMat()
+		normalized.ConvertTo(&level, gocv.MatTypeCV8UC3)
+		normalized.Close()
+
+		levels = append(levels, level)
+	}
+
+	return levels
+}
+
+// blendByDistance 根据像素到主体的距离在模糊层级之间插值
+func (br *BokehRenderer) blendByDistance(img, mask *gocv.Mat, levels []gocv.Mat, falloff int) (gocv.Mat, error) {
+	inverted := gocv.NewMat()
+	defer inverted.Close()
+	gocv.BitwiseNot(*mask, &inverted)
+
+	dist := gocv.NewMat()
+	defer dist.Close()
+	labels := gocv.NewMat()
+	defer labels.Close()
+	gocv.DistanceTransform(inverted, &dist, &labels, gocv.DistL2, gocv.DistanceMask5, gocv.DistanceLabelCComp)
+
+	distData, err := dist.DataPtrFloat32()
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+
+	// 层级 0 为原图，其余为逐渐增强的模糊
+	sources := make([][]uint8, 0, len(levels)+1)
+	imgData, err := img.DataPtrUint8()
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	sources = append(sources, imgData)
+	for i := range levels {
+		data, err := levels[i].DataPtrUint8()
+		if err != nil {
+			return gocv.NewMat(), err
+		}
+		sources = append(sources, data)
+	}
+
+	canvas := img.Clone()
+	out, err := canvas.DataPtrUint8()
+	if err != nil {
+		canvas.Close()
+		return gocv.NewMat(), err
+	}
+
+	maxLevel := float64(len(sources) - 1)
+	for i, d := range distData {
+		t := math.Min(1, float64(d)/float64(falloff)) * maxLevel
+		k := int(t)
+		if k >= len(sources)-1 {
+			k = len(sources) - 2
+		}
+		frac := t - float64(k)
+		lo, hi := sources[k], sources[k+1]
+		for ch := 0; ch < 3; ch++ {
+			j := i*3 + ch
+			out[j] = uint8(float64(lo[j])*(1-frac) + float64(hi[j])*frac + 0.5)
+		}
+	}
+
+	return canvas, nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// srgbD50 sRGB 原色经 Bradford 适配到 D50 后的 XYZ，与 sRGB IEC61966-2.1 配置文件的 rXYZ/gXYZ/bXYZ 一致
+var srgbD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// srgbEncodeLevels 线性值编码为 sRGB 时的查找表精度，暗部相邻两级之间小于 1 个 8 位色阶
+const srgbEncodeLevels = 1 << 14
+
+// srgbEncodeTable 线性值（按 srgbEncodeLevels 量化）到 8 位 sRGB 值的查找表
+var srgbEncodeTable = func() []uint8 {
+	table := make([]uint8, srgbEncodeLevels+1)
+	for i := range table {
+		table[i] = uint8(srgbEncode(float64(i)/srgbEncodeLevels)*255 + 0.5)
+	}
+	return table
+}()
+
+// convertToSRGB 按嵌入的 ICC 配置文件将 8 位 BGR 图像原地转换为 sRGB，返回是否进行了转换
+// 皮肤检测和颜色方差等分析都假定像素为 sRGB；没有配置文件、配置文件本身即 sRGB 或不是矩阵/TRC 型 RGB 配置文件时不转换
+func convertToSRGB(img *gocv.Mat, profile []byte) bool {
+	if len(profile) == 0 || img.Type() != gocv.MatTypeCV8UC3 {
+		return false
+	}
+	t, ok := newSRGBTransform(profile)
+	if !ok {
+		return false
+	}
+	data, err := img.DataPtrUint8()
+	if err != nil {
+		return false
+	}
+	t.apply(data)
+	return true
+}
+
+// srgbTransform 矩阵/TRC 型配置文件到 sRGB 的转换，采用相对色度意图，超出 sRGB 色域的颜色直接截断
+type srgbTransform struct {
+	// 各输入通道线性化后乘以矩阵系数的结果，逐像素只需查表和加法
+	contrib [3][3][256]float32 // [输出通道][输入通道][8 位值]，通道顺序为 R、G、B
+}
+
+// newSRGBTransform 根据配置文件构建转换，配置文件不受支持或与 sRGB 等价时返回 false
+func newSRGBTransform(profile []byte) (*srgbTransform, bool) {
+	p, ok := parseICCMatrixProfile(profile)
+	if !ok {
+		return nil, false
+	}
+	m := mul3(invert3(srgbD50), p.matrix)
+	if isSRGBProfile(p, m) {
+		return nil, false
+	}
+
+	t := &srgbTransform{}
+	for out := 0; out < 3; out++ {
+		for in := 0; in < 3; in++ {
+			for v := 0; v < 256; v++ {
+				t.contrib[out][in][v] = float32(m[out][in] * p.curves[in][v])
+			}
+		}
+	}
+	return t, true
+}
+
+// apply 原地转换连续的 BGR 像素
+func (t *srgbTransform) apply(data []uint8) {
+	c := &t.contrib
+	for i := 0; i+2 < len(data); i += 3 {
+		b, g, r := data[i], data[i+1], data[i+2]
+		data[i+2] = encodeSRGB(c[0][0][r] + c[0][1][g] + c[0][2][b])
+		data[i+1] = encodeSRGB(c[1][0][r] + c[1][1][g] + c[1][2][b])
+		data[i] = encodeSRGB(c[2][0][r] + c[2][1][g] + c[2][2][b])
+	}
+}
+
+// encodeSRGB 将线性值编码为 8 位 sRGB 值，超出 0-1 的值截断
+func encodeSRGB(linear float32) uint8 {
+	if linear <= 0 {
+		return 0
+	}
+	if linear >= 1 {
+		return 255
+	}
+	return srgbEncodeTable[int(linear*srgbEncodeLevels+0.5)]
+}
+
+// isSRGBProfile 判断配置文件与 sRGB 是否等价：原色一致，且各通道曲线与 sRGB 曲线相差不超过 1 个色阶
+// m 为配置文件 RGB 到 sRGB 线性 RGB 的矩阵
+func isSRGBProfile(p *iccMatrixProfile, m [3][3]float64) bool {
+	for row := range m {
+		for col := range m[row] {
+			identity := 0.0
+			if row == col {
+				identity = 1
+			}
+			if math.Abs(m[row][col]-identity) > 0.01 {
+				return false
+			}
+		}
+	}
+	for ch := range p.curves {
+		for v, linear := range p.curves[ch] {
+			if math.Abs(srgbEncode(linear)*255-float64(v)) > 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// srgbEncode sRGB 传递函数，将 0-1 的线性值编码为 0-1 的 sRGB 值
+func srgbEncode(linear float64) float64 {
+	if linear <= 0.0031308 {
+		return linear * 12.92
+	}
+	return 1.055*math.Pow(linear, 1/2.4) - 0.055
+}
+
+func mul3(a, b [3][3]float64) [3][3]float64 {
+	var c [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				c[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return c
+}
+
+func invert3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return [3][3]float64{
+		{(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det, (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det, (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det},
+		{(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det, (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det, (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det},
+		{(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det, (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det, (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det},
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// ErrInvalidParam 渲染参数无效
+var ErrInvalidParam = errors.New("invalid parameter")
+
+// CompositeSpec 背景替换参数
+type CompositeSpec struct {
+	Background      string  // 背景类型：color, gradient, image, blur
+	Color           string  // 纯色背景颜色，contain 模式下也用于填充空白区域
+	GradientFrom    string  // 渐变起始颜色
+	GradientTo      string  // 渐变结束颜色
+	GradientAngle   float64 // 渐变方向（角度），0 表示从左到右，90 表示从上到下
+	BackgroundImage []byte  // 背景图片数据
+	Fit             string  // 背景图片缩放方式：cover, contain
+	BlurRadius      int     // 模糊原图背景的半径（像素）
+	Feather         int     // 掩码羽化半径（像素）
+	Anchor          string  // 主体锚点：original, center, top, bottom, left, right, top-left, top-right, bottom-left, bottom-right
+	Scale           float64 // 主体缩放比例
+	OffsetX         int     // 主体水平偏移（像素）
+	OffsetY         int     // 主体垂直偏移（像素）
+	Format          string  // 输出格式：png, jpg, webp
+}
+
+// Compositor 负责将前景主体合成到新背景上
+type Compositor struct {
+	maskProcessor *MaskProcessor
+}
+
+func NewCompositor() *Compositor {
+	return &Compositor{
+		maskProcessor: NewMaskProcessor(),
+	}
+}
+
+// Composite 使用前景掩码将主体合成到指定背景上，返回编码后的图像及其 Content-Type
+func (cp *Compositor) Composite(imageData []byte, result *model.LayerResult, spec CompositeSpec) ([]byte, string, error) {
+	if spec.Feather > 100 {
+		return nil, "", fmt.Errorf("%w: feather must be <= 100", ErrInvalidParam)
+	}
+
+	img, err := decodeImage(imageData)
+	if err != nil {
+		return nil, "", err
+	}
+	defer img.Close()
+
+	layer, err := foregroundLayer(result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mask, err := decodeMask(layer.Mask, img.Cols(), img.Rows())
+	if err != nil {
+		return nil, "", err
+	}
+	defer mask.Close()
+
+	canvas, err := cp.background(&img, spec)
+	if err != nil {
+		return nil, "", err
+	}
+	defer canvas.Close()
+
+	alpha := cp.maskProcessor.Feather(&mask, spec.Feather)
+	defer alpha.Close()
+
+	if err := cp.placeSubject(&canvas, &img, &alpha, layer.BoundingBox, spec); err != nil {
+		return nil, "", err
+	}
+
+	return encodeImage(&canvas, spec.Format)
+}
+
+// background 根据参数生成与原图同尺寸的背景
+func (cp *Compositor) background(img *gocv.Mat, spec CompositeSpec) (gocv.Mat, error) {
+	width, height := img.Cols(), img.Rows()
+
+	switch spec.Background {
+	case "", "color":
+		c, err := parseHexColor(spec.Color)
+		if err != nil {
+			return gocv.NewMat(), fmt.Errorf("%w: color: %v", ErrInvalidParam, err)
+		}
+		return solidMat(width, height, c), nil
+
+	case "gradient":
+		from, err := parseHexColor(spec.GradientFrom)
+		if err != nil {
+			return gocv.NewMat(), fmt.Errorf("%w: gradient_from: %v", ErrInvalidParam, err)
+		}
+		to, err := parseHexColor(spec.GradientTo)
+		if err != nil {
+			return gocv.NewMat(), fmt.Errorf("%w: gradient_to: %v", ErrInvalidParam, err)
+		}
+		return gradientMat(width, height, from, to, spec.GradientAngle)
+
+	case "image":
+		if len(spec.BackgroundImage) == 0 {
+			return gocv.NewMat(), fmt.Errorf("%w: background image is required", ErrInvalidParam)
+		}
+		bg, err := decodeImage(spec.BackgroundImage)
+		if err != nil {
+			return gocv.NewMat(), fmt.Errorf("%w: background image: %v", ErrInvalidParam, err)
+		}
+		defer bg.Close()
+
+		fill := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		if spec.Color != "" {
+			if fill, err = parseHexColor(spec.Color); err != nil {
+				return gocv.NewMat(), fmt.Errorf("%w: color: %v", ErrInvalidParam, err)
+			}
+		}
+		return fitMat(&bg, width, height, spec.Fit, fill)
+
+	case "blur":
+		radius := spec.BlurRadius
+		if radius <= 0 {
+			radius = 25
+		}
+		if radius > 200 {
+			return gocv.NewMat(), fmt.Errorf("%w: blur radius must be <= 200", ErrInvalidParam)
+		}
+		blurred := gocv.NewMat()
+		gocv.GaussianBlur(*img, &blurred, image.Point{X: radius*2 + 1, Y: radius*2 + 1}, 0, 0, gocv.BorderReflect101)
+		return blurred, nil
+
+	default:
+		return gocv.NewMat(), fmt.Errorf("%w: unknown background type %q", ErrInvalidParam, spec.Background)
+	}
+}
+
+// placeSubject 按锚点、缩放和偏移将主体叠加到画布上
+func (cp *Compositor) placeSubject(canvas, img, alpha *gocv.Mat, bbox model.BBox, spec CompositeSpec) error {
+	scale := spec.Scale
+	if scale == 0 {
+		scale = 1.0
+	}
+	if scale < 0 || scale > 10 {
+		return fmt.Errorf("%w: scale must be in (0, 10]", ErrInvalidParam)
+	}
+
+	// 羽化后的软边缘会超出边界框，裁剪时按羽化半径外扩
+	rect := image.Rect(bbox.X, bbox.Y, bbox.X+bbox.Width, bbox.Y+bbox.Height).
+		Inset(-max(0, spec.Feather)).
+		Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil
+	}
+
+	subjectRegion := img.Region(rect)
+	subject := subjectRegion.Clone()
+	subjectRegion.Close()
+	defer subject.Close()
+
+	alphaRegion := alpha.Region(rect)
+	subjectAlpha := alphaRegion.Clone()
+	alphaRegion.Close()
+	defer subjectAlpha.Close()
+
+	if scale != 1.0 {
+		size := image.Point{
+			X: max(1, int(math.Round(float64(rect.Dx())*scale))),
+			Y: max(1, int(math.Round(float64(rect.Dy())*scale))),
+		}
+		gocv.Resize(subject, &subject, size, 0, 0, gocv.InterpolationLinear)
+		gocv.Resize(subjectAlpha, &subjectAlpha, size, 0, 0, gocv.InterpolationLinear)
+	}
+
+	size := image.Point{X: subject.Cols(), Y: subject.Rows()}
+	origin, err := anchorOrigin(spec.Anchor, image.Point{X: canvas.Cols(), Y: canvas.Rows()}, size, rect)
+	if err != nil {
+		return err
+	}
+	origin = origin.Add(image.Point{X: spec.OffsetX, Y: spec.OffsetY})
+
+	alphaBlend(canvas, &subject, &subjectAlpha, origin)
+	return nil
+}
+
+// anchorOrigin 计算尺寸为 size 的主体在画布上的左上角位置
+// original 锚点以主体在原图中的中心为基准缩放
+func anchorOrigin(anchor string, canvas, size image.Point, original image.Rectangle) (image.Point, error) {
+	centerX := (canvas.X - size.X) / 2
+	centerY := (canvas.Y - size.Y) / 2
+	right := canvas.X - size.X
+	bottom := canvas.Y - size.Y
+
+	switch anchor {
+	case "", "original":
+		return image.Point{
+			X: original.Min.X + (original.Dx()-size.X)/2,
+			Y: original.Min.Y + (original.Dy()-size.Y)/2,
+		}, nil
+	case "center":
+		return image.Point{X: centerX, Y: centerY}, nil
+	case "top":
+		return image.Point{X: centerX, Y: 0}, nil
+	case "bottom":
+		return image.Point{X: centerX, Y: bottom}, nil
+	case "left":
+		return image.Point{X: 0, Y: centerY}, nil
+	case "right":
+		return image.Point{X: right, Y: centerY}, nil
+	case "top-left":
+		return image.Point{X: 0, Y: 0}, nil
+	case "top-right":
+		return image.Point{X: right, Y: 0}, nil
+	case "bottom-left":
+		return image.Point{X: 0, Y: bottom}, nil
+	case "bottom-right":
+		return image.Point{X: right, Y: bottom}, nil
+	default:
+		return image.Point{}, fmt.Errorf("%w: unknown anchor %q", ErrInvalidParam, anchor)
+	}
+}
+
+// solidMat 创建指定颜色的纯色 BGR 图像
+func solidMat(width, height int, c color.RGBA) gocv.Mat {
+	return gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(c.B), float64(c.G), float64(c.R), 0), height, width, gocv.MatTypeCV8UC3)
+}
+
+// gradientMat 创建沿 angle 方向从 from 过渡到 to 的线性渐变 BGR 图像
+func gradientMat(width, height int, from, to color.RGBA, angle float64) (gocv.Mat, error) {
+	rad := angle * math.Pi / 180
+	dx, dy := math.Cos(rad), math.Sin(rad)
+
+	// 以四个角点在渐变方向上的投影范围作为 0-1 区间
+	minP, maxP := math.Inf(1), math.Inf(-1)
+	for _, p := range [][2]float64{{0, 0}, {float64(width - 1), 0}, {0, float64(height - 1)}, {float64(width - 1), float64(height - 1)}} {
+		proj := p[0]*dx + p[1]*dy
+		minP = math.Min(minP, proj)
+		maxP = math.Max(maxP, proj)
+	}
+	span := maxP - minP
+	if span == 0 {
+		span = 1
+	}
+
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+
+	data := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			t := (float64(x)*dx + float64(y)*dy - minP) / span
+			i := (y*width + x) * 3
+			data[i] = lerp(from.B, to.B, t)
+			data[i+1] = lerp(from.G, to.G, t)
+			data[i+2] = lerp(from.R, to.R, t)
+		}
+	}
+
+	return gocv.NewMatFromBytes(height, width, gocv.MatTypeCV8UC3, data)
+}
+
+// fitMat 将图像缩放到 width x height
+// cover 等比放大铺满后居中裁剪，contain 等比缩放完整显示并用 fill 填充空白
+func fitMat(src *gocv.Mat, width, height int, fit string, fill color.RGBA) (gocv.Mat, error) {
+	sw, sh := float64(src.Cols()), float64(src.Rows())
+
+	var scale float64
+	switch fit {
+	case "", "cover":
+		scale = math.Max(float64(width)/sw, float64(height)/sh)
+	case "contain":
+		scale = math.Min(float64(width)/sw, float64(height)/sh)
+	default:
+		return gocv.NewMat(), fmt.Errorf("%w: unknown fit mode %q", ErrInvalidParam, fit)
+	}
+
+	size := image.Point{
+		X: max(1, int(math.Round(sw*scale))),
+		Y: max(1, int(math.Round(sh*scale))),
+	}
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(*src, &resized, size, 0, 0, gocv.InterpolationArea)
+
+	canvas := solidMat(width, height, fill)
+	offset := image.Point{X: (width - size.X) / 2, Y: (height - size.Y) / 2}
+
+	// 计算源与画布的重叠区域后直接复制
+	dstRect := image.Rectangle{Min: offset, Max: offset.Add(size)}.Intersect(image.Rect(0, 0, width, height))
+	srcRect := dstRect.Sub(offset)
+
+	srcRegion := resized.Region(srcRect)
+	defer srcRegion.Close()
+	dstRegion := canvas.Region(dstRect)
+	defer dstRegion.Close()
+	srcRegion.CopyTo(&dstRegion)
+
+	return canvas, nil
+}
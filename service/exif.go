@@ -0,0 +1,213 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// EXIF 标签
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	gpsTagLatitudeRef       = 0x0001
+	gpsTagLatitude          = 0x0002
+	gpsTagLongitudeRef      = 0x0003
+	gpsTagLongitude         = 0x0004
+)
+
+var errInvalidExif = errors.New("invalid exif data")
+
+// exifData 从 EXIF 中提取的字段
+type exifData struct {
+	Make             string
+	Model            string
+	Orientation      int
+	DateTime         string
+	DateTimeOriginal string
+	HasGPS           bool
+	Latitude         float64
+	Longitude        float64
+}
+
+// exifEntry IFD 中的一条记录
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // 值所在的原始字节（已按偏移解析）
+}
+
+// parseExif 解析 TIFF 结构的 EXIF 数据（不含 "Exif\0\0" 前缀）
+func parseExif(data []byte) (*exifData, error) {
+	if len(data) < 8 {
+		return nil, errInvalidExif
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errInvalidExif
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errInvalidExif
+	}
+
+	ifd0, err := readIFD(data, order, order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	exif := &exifData{}
+	for _, e := range ifd0 {
+		switch e.tag {
+		case exifTagMake:
+			exif.Make = e.ascii()
+		case exifTagModel:
+			exif.Model = e.ascii()
+		case exifTagOrientation:
+			exif.Orientation = int(e.number(order))
+		case exifTagDateTime:
+			exif.DateTime = e.ascii()
+		case exifTagExifIFD:
+			if sub, err := readIFD(data, order, e.number(order)); err == nil {
+				for _, se := range sub {
+					if se.tag == exifTagDateTimeOriginal {
+						exif.DateTimeOriginal = se.ascii()
+					}
+				}
+			}
+		case exifTagGPSIFD:
+			if sub, err := readIFD(data, order, e.number(order)); err == nil {
+				exif.parseGPS(sub, order)
+			}
+		}
+	}
+
+	return exif, nil
+}
+
+func (x *exifData) parseGPS(entries []exifEntry, order binary.ByteOrder) {
+	var latRef, lonRef string
+	var lat, lon []float64
+	for _, e := range entries {
+		switch e.tag {
+		case gpsTagLatitudeRef:
+			latRef = e.ascii()
+		case gpsTagLatitude:
+			lat = e.rationals(order)
+		case gpsTagLongitudeRef:
+			lonRef = e.ascii()
+		case gpsTagLongitude:
+			lon = e.rationals(order)
+		}
+	}
+	if len(lat) != 3 || len(lon) != 3 {
+		return
+	}
+
+	x.HasGPS = true
+	x.Latitude = lat[0] + lat[1]/60 + lat[2]/3600
+	x.Longitude = lon[0] + lon[1]/60 + lon[2]/3600
+	if latRef == "S" {
+		x.Latitude = -x.Latitude
+	}
+	if lonRef == "W" {
+		x.Longitude = -x.Longitude
+	}
+}
+
+// readIFD 读取 offset 处的 IFD 记录
+func readIFD(data []byte, order binary.ByteOrder, offset uint32) ([]exifEntry, error) {
+	if int(offset)+2 > len(data) {
+		return nil, errInvalidExif
+	}
+	count := int(order.Uint16(data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(data) {
+		return nil, errInvalidExif
+	}
+
+	entries := make([]exifEntry, 0, count)
+	for i := 0; i < count; i++ {
+		raw := data[start+i*12 : start+i*12+12]
+		e := exifEntry{
+			tag:   order.Uint16(raw[0:2]),
+			typ:   order.Uint16(raw[2:4]),
+			count: order.Uint32(raw[4:8]),
+		}
+
+		size := exifTypeSize(e.typ) * int(e.count)
+		if size <= 0 || size > len(data) {
+			continue
+		}
+		if size <= 4 {
+			e.value = raw[8 : 8+size]
+		} else {
+			valueOffset := int(order.Uint32(raw[8:12]))
+			if valueOffset+size > len(data) {
+				continue
+			}
+			e.value = data[valueOffset : valueOffset+size]
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
+
+func (e exifEntry) ascii() string {
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+func (e exifEntry) number(order binary.ByteOrder) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(order.Uint16(e.value))
+	case (e.typ == 4 || e.typ == 9) && len(e.value) >= 4:
+		return order.Uint32(e.value)
+	default:
+		return 0
+	}
+}
+
+func (e exifEntry) rationals(order binary.ByteOrder) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	values := make([]float64, 0, e.count)
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num := order.Uint32(e.value[i:])
+		den := order.Uint32(e.value[i+4:])
+		if den == 0 {
+			values = append(values, 0)
+			continue
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
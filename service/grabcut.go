@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"image"
+	"os"
 	"time"
 
 	"github.com/TIANLI0/LayerKit/config"
@@ -14,54 +15,139 @@ import (
 	"gocv.io/x/gocv"
 )
 
+// PipelineVersion 当前处理管线版本
+// 任何会改变分层结果的算法或参数调整都需要递增，旧管线的缓存结果将被视为未命中
+const PipelineVersion = 5
+
 // GrabCutService 负责图像分层处理
 type GrabCutService struct {
 	iterations         int
 	borderSize         int
 	semaphore          chan struct{}
 	queueTimeout       time.Duration
-	cleanupTempFiles   bool
+	alphaPrior         string
 	complexityAnalyzer *ComplexityAnalyzer
 	saliencyDetector   *SaliencyDetector
 	maskProcessor      *MaskProcessor
 	portraitDetector   *PortraitDetector
+	shapeAnalyzer      *ShapeAnalyzer
+	metadataExtractor  *MetadataExtractor
+}
+
+// ProcessOptions 分层处理选项
+type ProcessOptions struct {
+	MaxForegroundOnly bool // 仅保留最大的前景连通区域
+	ShapeDescriptors  bool // 计算每个图层的形状描述
+	StoredOrientation bool // 掩码和坐标按像素存储方向返回，而不是按 EXIF Orientation 转正后的方向
+}
+
+// CacheKey 返回按处理选项区分的缓存键
+func (o ProcessOptions) CacheKey(md5 string) string {
+	key := md5
+	if o.MaxForegroundOnly {
+		key += ":max_fg"
+	}
+	if o.ShapeDescriptors {
+		key += ":shape"
+	}
+	if o.StoredOrientation {
+		key += ":stored"
+	}
+	return key
 }
 
-func NewGrabCutService(cfg *config.GrabCutConfig) *GrabCutService {
+func NewGrabCutService(cfg *config.GrabCutConfig, uploadCfg *config.UploadConfig) *GrabCutService {
 	return &GrabCutService{
 		iterations:         cfg.Iterations,
 		borderSize:         cfg.BorderSize,
 		semaphore:          make(chan struct{}, cfg.MaxConcurrent),
 		queueTimeout:       time.Duration(cfg.QueueTimeout) * time.Second,
-		cleanupTempFiles:   cfg.CleanupTempFiles,
+		alphaPrior:         cfg.AlphaPrior,
 		complexityAnalyzer: NewComplexityAnalyzer(),
 		saliencyDetector:   NewSaliencyDetector(),
 		maskProcessor:      NewMaskProcessor(),
 		portraitDetector:   NewPortraitDetector(),
+		shapeAnalyzer:      NewShapeAnalyzer(),
+		metadataExtractor:  NewMetadataExtractor(uploadCfg.KeepGPS),
 	}
 }
 
-// ProcessImage 处理图片并返回分层结果
-func (s *GrabCutService) ProcessImage(imagePath string, md5 string, maxForegroundOnly bool) (*model.LayerResult, error) {
-	// 并发控制
-	ctx, cancel := context.WithTimeout(context.Background(), s.queueTimeout)
-	defer cancel()
+// ProcessImage 处理图片文件并返回分层结果
+func (s *GrabCutService) ProcessImage(imagePath string, md5 string, opts ProcessOptions) (*model.LayerResult, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	return s.process(data, md5, opts, nil, s.acquire)
+}
 
-	select {
-	case s.semaphore <- struct{}{}:
-		defer func() { <-s.semaphore }()
-	case <-ctx.Done():
-		return nil, fmt.Errorf("处理队列已满，请稍后重试")
+// ProcessImageData 处理内存中的图片数据并返回分层结果，全程不读写磁盘
+func (s *GrabCutService) ProcessImageData(data []byte, md5 string, opts ProcessOptions) (*model.LayerResult, error) {
+	return s.process(data, md5, opts, nil, s.acquire)
+}
+
+// ProcessQueuedData 与 ProcessImageData 相同，但一直等待处理名额直到 ctx 结束，不受 queue_timeout 限制
+// 供异步任务的工作协程使用：任务已在队列中排过队，名额被同步请求占满时应继续等待而不是失败
+func (s *GrabCutService) ProcessQueuedData(ctx context.Context, data []byte, md5 string, opts ProcessOptions) (*model.LayerResult, error) {
+	return s.process(data, md5, opts, nil, func() (func(), error) {
+		return s.acquireWait(ctx)
+	})
+}
+
+// TraceImage 与 ProcessImageData 相同，额外记录每个阶段的中间产物和耗时，用于排查分层错误
+func (s *GrabCutService) TraceImage(data []byte, md5 string, opts ProcessOptions) (*model.LayerResult, *PipelineTrace, error) {
+	trace := newPipelineTrace()
+	result, err := s.process(data, md5, opts, trace, s.acquire)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, trace, nil
+}
+
+// process 执行分层管线，trace 非 nil 时记录各阶段产物，acquire 决定如何等待处理名额
+func (s *GrabCutService) process(data []byte, md5 string, opts ProcessOptions, trace *PipelineTrace, acquire func() (func(), error)) (*model.LayerResult, error) {
+	// 超出像素上限的图片在排队前拒绝
+	info := probeImage(data)
+	reduce, err := checkPixels(info)
+	if err != nil {
+		return nil, err
 	}
 
+	// 并发控制
+	release, err := acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	startTime := time.Now()
+	if trace != nil {
+		// 排队时间不计入各阶段
+		trace.start, trace.last = startTime, startTime
+	}
 
-	// 读取图片
-	img := gocv.IMRead(imagePath, gocv.IMReadColor)
-	if img.Empty() {
-		return nil, fmt.Errorf("failed to read image")
+	// 元数据需在 OpenCV 解码前提取
+	metadata := s.metadataExtractor.Extract(data, md5)
+
+	img, err := decodeStored(data)
+	if err != nil {
+		return nil, err
 	}
 	defer img.Close()
+	trace.record("decode", nil)
+
+	// 分析假定像素为 sRGB，嵌入了其他色彩空间配置文件的图片先转换；导出接口仍使用原图像素
+	colorConverted := convertToSRGB(&img, info.ICC)
+	if colorConverted {
+		trace.record("to_srgb", &img)
+	}
+
+	// 始终在转正后的图像上分割，显著性和人像检测都假定主体是正向的
+	orientation := exifOrientation(data)
+	if orientation != 1 {
+		orientUpright(&img, orientation)
+		trace.record("orient", &img)
+	}
 
 	width := img.Cols()
 	height := img.Rows()
@@ -69,19 +155,161 @@ func (s *GrabCutService) ProcessImage(imagePath string, md5 string, maxForegroun
 	utils.Logger.Info("processing image",
 		zap.String("md5", md5),
 		zap.Int("width", width),
-		zap.Int("height", height))
+		zap.Int("height", height),
+		zap.Int("decode_reduce", reduce),
+		zap.Bool("color_converted", colorConverted))
+
+	// 透明通道作为分割先验
+	alpha, alphaPrior := s.loadAlphaPrior(data, orientation)
+	defer alpha.Close()
+	trace.record("alpha_prior", &alpha)
+
+	var fgMask gocv.Mat
+	var complexity ComplexityInfo
+	if alphaPrior == AlphaPriorCutout {
+		// 透明通道已经定义了前景，跳过分割
+		fgMask = gocv.NewMat()
+		gocv.Threshold(alpha, &fgMask, 127, 255, gocv.ThresholdBinary)
+		trace.record("cutout", &fgMask)
+	} else {
+		fgMask, complexity = s.segment(&img, &alpha, trace)
+	}
+	defer fgMask.Close()
+
+	// 缩小解码的大图将掩码放大回原图尺寸，结果的宽高和坐标始终对应原图
+	if reduce > 1 {
+		width, height = uprightSize(info, orientation)
+		if fgMask.Cols() != width || fgMask.Rows() != height {
+			gocv.Resize(fgMask, &fgMask, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationLinear)
+			gocv.Threshold(fgMask, &fgMask, 127, 255, gocv.ThresholdBinary)
+			trace.record("restore_size", &fgMask)
+		}
+	}
+
+	if opts.MaxForegroundOnly {
+		largest := s.maskProcessor.KeepLargest(&fgMask)
+		fgMask.Close()
+		fgMask = largest
+		trace.record("keep_largest", &fgMask)
+	}
+
+	output := OrientationUpright
+	if opts.StoredOrientation {
+		output = OrientationStored
+		if orientation != 1 {
+			orientStored(&fgMask, orientation)
+			width, height = fgMask.Cols(), fgMask.Rows()
+			trace.record("orient_stored", &fgMask)
+		}
+	}
+	fgBBox := s.calculateBoundingBox(&fgMask)
+	fgMaskBase64 := s.encodeMask(&fgMask)
+
+	bgMask := gocv.NewMat()
+	defer bgMask.Close()
+	gocv.BitwiseNot(fgMask, &bgMask)
+	bgMaskBase64 := s.encodeMask(&bgMask)
+
+	fgConfidence := s.calculateConfidence(&fgMask, width, height)
+
+	result := &model.LayerResult{
+		SchemaVersion:   model.SchemaVersion,
+		PipelineVersion: PipelineVersion,
+		MD5:             md5,
+		Width:           width,
+		Height:          height,
+		Timestamp:       time.Now().Unix(),
+		Metadata:        metadata,
+		Orientation: &model.Orientation{
+			Exif:      orientation,
+			Transform: orientationTransforms[orientation],
+			Output:    output,
+		},
+		AlphaPrior:     alphaPrior,
+		Complexity:     complexity.Level,
+		ColorConverted: colorConverted,
+		Layers: []model.Layer{
+			{
+				ID:          1,
+				Type:        "foreground",
+				BoundingBox: fgBBox,
+				Mask:        fgMaskBase64,
+				Confidence:  fgConfidence,
+			},
+			{
+				ID:          2,
+				Type:        "background",
+				BoundingBox: model.BBox{X: 0, Y: 0, Width: width, Height: height},
+				Mask:        bgMaskBase64,
+				Confidence:  1.0 - fgConfidence,
+			},
+		},
+	}
+
+	if opts.ShapeDescriptors {
+		result.Layers[0].Shape = s.shapeAnalyzer.Describe(&fgMask)
+		result.Layers[1].Shape = s.shapeAnalyzer.Describe(&bgMask)
+	}
+	trace.record("encode", nil)
+
+	utils.Logger.Info("image processed successfully",
+		zap.String("md5", md5),
+		zap.Duration("duration", time.Since(startTime)),
+		zap.Float64("foreground_confidence", fgConfidence),
+		zap.String("complexity", complexity.Level),
+		zap.String("alpha_prior", alphaPrior))
+
+	return result, nil
+}
+
+// acquire 占用一个处理名额，排队超时返回错误；成功时返回释放函数
+func (s *GrabCutService) acquire() (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.queueTimeout)
+	defer cancel()
+
+	select {
+	case s.semaphore <- struct{}{}:
+		return func() { <-s.semaphore }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("处理队列已满，请稍后重试")
+	}
+}
+
+// Acquire 占用一个处理名额，供不经过 Process 的重负载渲染（如叠加预览、联系表）共用同一并发上限
+func (s *GrabCutService) Acquire() (func(), error) {
+	return s.acquire()
+}
 
+// acquireWait 占用一个处理名额，一直等待直到 ctx 结束
+func (s *GrabCutService) acquireWait(ctx context.Context) (func(), error) {
+	select {
+	case s.semaphore <- struct{}{}:
+		return func() { <-s.semaphore }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// segment 在缩放后的图像上执行 GrabCut 分割及掩码优化，返回原始尺寸的前景掩码和场景复杂度
+// alpha 非空时用于初始化 GrabCut 掩码
+func (s *GrabCutService) segment(img, alpha *gocv.Mat, trace *PipelineTrace) (gocv.Mat, ComplexityInfo) {
 	// 智能缩放
-	scaledImg, scale := s.smartResize(&img, 1200)
+	scaledImg, scale := s.smartResize(img, 1200)
 	defer scaledImg.Close()
 
 	scaledWidth := scaledImg.Cols()
 	scaledHeight := scaledImg.Rows()
+	trace.record("resize", &scaledImg)
 
 	complexity := s.complexityAnalyzer.Analyze(&scaledImg)
 	utils.Logger.Info("scene analyzed",
 		zap.String("level", complexity.Level),
 		zap.Bool("is_portrait", complexity.IsPortrait))
+	if trace != nil {
+		trace.Complexity = complexity
+		trace.Scale = scale
+	}
+	trace.record("complexity", nil)
 
 	var initRect image.Rectangle
 	var mask gocv.Mat
@@ -96,12 +324,20 @@ func (s *GrabCutService) ProcessImage(imagePath string, md5 string, maxForegroun
 	} else {
 		saliencyMap := s.saliencyDetector.Detect(&scaledImg)
 		defer saliencyMap.Close()
+		trace.record("saliency", &saliencyMap)
 
 		initRect = s.saliencyDetector.ExtractRect(&saliencyMap, scaledWidth, scaledHeight)
 		mask = s.saliencyDetector.CreateMask(&saliencyMap, scaledWidth, scaledHeight)
 	}
 	defer mask.Close()
 
+	if !alpha.Empty() {
+		// 完全透明的像素作为确定背景，初始矩形收缩到不透明区域
+		initRect = seedWithAlpha(&mask, alpha, initRect, image.Point{X: scaledWidth, Y: scaledHeight})
+	}
+	trace.recordRect("init_rect", &scaledImg, initRect)
+	trace.recordGrabCutMask("seed_mask", &mask)
+
 	bgdModel := gocv.NewMat()
 	defer bgdModel.Close()
 	fgdModel := gocv.NewMat()
@@ -126,18 +362,21 @@ func (s *GrabCutService) ProcessImage(imagePath string, md5 string, maxForegroun
 	if complexity.Level != "simple" {
 		gocv.GrabCut(scaledImg, &mask, image.Rectangle{}, &bgdModel, &fgdModel, 2, gocv.GCInitWithMask)
 	}
+	trace.recordGrabCutMask("grabcut", &mask)
 
 	fgMask := s.maskProcessor.ExtractForeground(&mask)
-	defer fgMask.Close()
+	trace.record("foreground", &fgMask)
 
 	if complexity.IsPortrait {
 		enhanced := s.portraitDetector.EnhancePortraitMask(&fgMask, &scaledImg)
 		fgMask.Close()
 		fgMask = enhanced
+		trace.record("skin_enhance", &fgMask)
 
 		detailRefined := s.maskProcessor.DetailPreservingRefine(&fgMask, &scaledImg)
 		fgMask.Close()
 		fgMask = detailRefined
+		trace.record("detail_refine", &fgMask)
 	}
 
 	kernelSize := 3
@@ -147,67 +386,26 @@ func (s *GrabCutService) ProcessImage(imagePath string, md5 string, maxForegroun
 	optimized := s.maskProcessor.MorphologyOptimize(&fgMask, kernelSize)
 	fgMask.Close()
 	fgMask = optimized
+	trace.record("morphology", &fgMask)
 
 	if complexity.Level != "simple" {
 		refined := s.maskProcessor.RefineEdges(&fgMask)
 		fgMask.Close()
 		fgMask = refined
+		trace.record("refine_edges", &fgMask)
 	}
 
 	// 还原到原始尺寸
 	if scale != 1.0 {
 		resizedMask := gocv.NewMat()
-		gocv.Resize(fgMask, &resizedMask, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationLinear)
+		gocv.Resize(fgMask, &resizedMask, image.Point{X: img.Cols(), Y: img.Rows()}, 0, 0, gocv.InterpolationLinear)
 		gocv.Threshold(resizedMask, &resizedMask, 127, 255, gocv.ThresholdBinary)
 		fgMask.Close()
 		fgMask = resizedMask
+		trace.record("upscale", &fgMask)
 	}
 
-	if maxForegroundOnly {
-		largest := s.maskProcessor.KeepLargest(&fgMask)
-		fgMask.Close()
-		fgMask = largest
-	}
-	fgBBox := s.calculateBoundingBox(&fgMask)
-	fgMaskBase64 := s.encodeMask(&fgMask)
-
-	bgMask := gocv.NewMat()
-	defer bgMask.Close()
-	gocv.BitwiseNot(fgMask, &bgMask)
-	bgMaskBase64 := s.encodeMask(&bgMask)
-
-	fgConfidence := s.calculateConfidence(&fgMask, width, height)
-
-	result := &model.LayerResult{
-		MD5:       md5,
-		Width:     width,
-		Height:    height,
-		Timestamp: time.Now().Unix(),
-		Layers: []model.Layer{
-			{
-				ID:          1,
-				Type:        "foreground",
-				BoundingBox: fgBBox,
-				Mask:        fgMaskBase64,
-				Confidence:  fgConfidence,
-			},
-			{
-				ID:          2,
-				Type:        "background",
-				BoundingBox: model.BBox{X: 0, Y: 0, Width: width, Height: height},
-				Mask:        bgMaskBase64,
-				Confidence:  1.0 - fgConfidence,
-			},
-		},
-	}
-
-	utils.Logger.Info("image processed successfully",
-		zap.String("md5", md5),
-		zap.Duration("duration", time.Since(startTime)),
-		zap.Float64("foreground_confidence", fgConfidence),
-		zap.String("complexity", complexity.Level))
-
-	return result, nil
+	return fgMask, complexity
 }
 
 // calculateBoundingBox 计算掩码的边界框
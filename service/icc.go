@@ -0,0 +1,204 @@
+package service
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// iccTag ICC 配置文件中的一个标签
+type iccTag struct {
+	offset int
+	size   int
+}
+
+// iccTags 读取 ICC 配置文件的标签表
+func iccTags(profile []byte) map[string]iccTag {
+	if len(profile) < 132 {
+		return nil
+	}
+
+	// 标签数来自文件头，不可信，按实际能容纳的条目数截断后再分配
+	count := min(int(binary.BigEndian.Uint32(profile[128:])), (len(profile)-132)/12)
+	tags := make(map[string]iccTag, count)
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(profile) {
+			break
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) {
+			continue
+		}
+		tags[string(profile[entry:entry+4])] = iccTag{offset: offset, size: size}
+	}
+
+	return tags
+}
+
+// iccProfileName 读取 ICC 配置文件的描述（desc 标签），兼容 v2 的 desc 类型和 v4 的 mluc 类型
+func iccProfileName(profile []byte) string {
+	tag, ok := iccTags(profile)["desc"]
+	if !ok || tag.size < 12 {
+		return ""
+	}
+	data := profile[tag.offset : tag.offset+tag.size]
+
+	switch string(data[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		if n <= 0 || 12+n > len(data) {
+			return ""
+		}
+		return strings.TrimSpace(strings.TrimRight(string(data[12:12+n]), "\x00"))
+
+	case "mluc":
+		// 多语言记录，取第一条
+		if len(data) < 28 || binary.BigEndian.Uint32(data[8:]) == 0 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(data[20:]))
+		offset := int(binary.BigEndian.Uint32(data[24:]))
+		if length <= 0 || offset+length > len(data) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(data[offset+i*2:])
+		}
+		return strings.TrimSpace(strings.TrimRight(string(utf16.Decode(units)), "\x00"))
+	}
+
+	return ""
+}
+
+// iccMatrixProfile 矩阵/TRC 型 RGB 配置文件：各通道经 TRC 线性化后乘以原色矩阵得到 PCS 中的 XYZ（D50）
+type iccMatrixProfile struct {
+	matrix [3][3]float64   // 行为 X、Y、Z，列为 R、G、B
+	curves [3][256]float64 // R、G、B 通道 8 位值线性化后的结果，范围 0-1
+}
+
+// parseICCMatrixProfile 解析矩阵/TRC 型 RGB 配置文件（Adobe RGB、Display P3、ProPhoto 等相机和显示器配置文件均属此类）
+// 仅含 LUT 的配置文件、CMYK 和灰度配置文件返回 false
+func parseICCMatrixProfile(profile []byte) (*iccMatrixProfile, bool) {
+	if len(profile) < 132 || string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil, false
+	}
+	tags := iccTags(profile)
+
+	p := &iccMatrixProfile{}
+	for ch, prefix := range []string{"r", "g", "b"} {
+		xyz, ok := iccXYZ(profile, tags[prefix+"XYZ"])
+		if !ok {
+			return nil, false
+		}
+		for row := range xyz {
+			p.matrix[row][ch] = xyz[row]
+		}
+
+		curve, ok := iccCurve(profile, tags[prefix+"TRC"])
+		if !ok {
+			return nil, false
+		}
+		for v := range p.curves[ch] {
+			y := curve(float64(v) / 255)
+			if math.IsNaN(y) {
+				y = 0
+			}
+			p.curves[ch][v] = math.Max(0, math.Min(1, y))
+		}
+	}
+	return p, true
+}
+
+// iccXYZ 读取 XYZ 类型标签
+func iccXYZ(profile []byte, tag iccTag) ([3]float64, bool) {
+	if tag.size < 20 || string(profile[tag.offset:tag.offset+4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	data := profile[tag.offset:]
+	return [3]float64{s15Fixed16(data[8:]), s15Fixed16(data[12:]), s15Fixed16(data[16:])}, true
+}
+
+// iccCurve 读取 curv 或 para 类型的色调响应曲线
+func iccCurve(profile []byte, tag iccTag) (func(float64) float64, bool) {
+	if tag.size < 12 {
+		return nil, false
+	}
+	data := profile[tag.offset : tag.offset+tag.size]
+
+	switch string(data[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(data[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, true
+		case n == 1 && len(data) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(data[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		case n > 1 && len(data) >= 12+n*2:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(data[12+i*2:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := min(int(pos), n-2)
+				return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+			}, true
+		}
+
+	case "para":
+		// 参数曲线，函数类型 0-4 分别有 1、3、4、5、7 个参数
+		counts := []int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(data[8:]))
+		if kind >= len(counts) || len(data) < 12+counts[kind]*4 {
+			return nil, false
+		}
+		var g [7]float64
+		for i := 0; i < counts[kind]; i++ {
+			g[i] = s15Fixed16(data[12+i*4:])
+		}
+		gamma, a, b, c, d, e, f := g[0], g[1], g[2], g[3], g[4], g[5], g[6]
+		switch kind {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		case 1:
+			return func(x float64) float64 {
+				if a == 0 || x < -b/a {
+					return 0
+				}
+				return math.Pow(a*x+b, gamma)
+			}, true
+		case 2:
+			return func(x float64) float64 {
+				if a == 0 || x < -b/a {
+					return c
+				}
+				return math.Pow(a*x+b, gamma) + c
+			}, true
+		case 3:
+			return func(x float64) float64 {
+				if x < d {
+					return c * x
+				}
+				return math.Pow(a*x+b, gamma)
+			}, true
+		case 4:
+			return func(x float64) float64 {
+				if x < d {
+					return c*x + f
+				}
+				return math.Pow(a*x+b, gamma) + e
+			}, true
+		}
+	}
+
+	return nil, false
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"gocv.io/x/gocv"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// decodeImage 将图片解码为 8 位 3 通道 BGR 图像并按 EXIF Orientation 转正，后续分析和渲染均假定这一格式
+func decodeImage(data []byte) (gocv.Mat, error) {
+	img, err := decodeStored(data)
+	if err != nil {
+		return img, err
+	}
+	orientUpright(&img, exifOrientation(data))
+	return img, nil
+}
+
+// decodeStored 将图片解码为 8 位 3 通道 BGR 图像，保持像素的存储方向
+// 优先使用 OpenCV，IMReadColor 会把 16 位、灰度、调色板和带 alpha 的图像统一转换为 8 位 BGR；
+// OpenCV 默认会自动应用 EXIF 方向而 Go 解码器不会，因此统一忽略方向，由调用方显式处理
+// GIF 及 OpenCV 未编译对应编解码器（常见于 WebP、TIFF）时回退到 Go 解码器
+// 解码前按文件头尺寸检查像素上限，超过 decode_megapixels 的图片缩小解码，返回的图像可能小于原图
+func decodeStored(data []byte) (gocv.Mat, error) {
+	return decodeReduced(data, 1)
+}
+
+// decodePreview 只需要长边不超过 maxSide 的预览时使用，upright 为 true 时按 EXIF Orientation 转正
+// 在像素上限要求的倍数之外进一步缩小解码，JPEG 不会分配全尺寸图像；返回的图像长边不小于 maxSide（原图更小时除外）
+func decodePreview(data []byte, upright bool, maxSide int) (gocv.Mat, error) {
+	img, err := decodeReduced(data, previewReduce(probeImage(data), maxSide))
+	if err != nil {
+		return img, err
+	}
+	if upright {
+		orientUpright(&img, exifOrientation(data))
+	}
+	return img, nil
+}
+
+// previewReduce 返回长边缩小后仍不小于 maxSide 的最大缩小倍数（1、2、4 或 8）
+func previewReduce(info *imageInfo, maxSide int) int {
+	side := max(info.Width, info.Height)
+	reduce := 1
+	for reduce < 8 && side/(reduce*2) >= maxSide {
+		reduce *= 2
+	}
+	return reduce
+}
+
+// decodeReduced decodeStored 的实现，缩小倍数取 minReduce 与像素上限要求的倍数中较大者
+func decodeReduced(data []byte, minReduce int) (gocv.Mat, error) {
+	info := probeImage(data)
+	reduce, err := checkPixels(info)
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	reduce = max(reduce, minReduce)
+
+	if info.Format != "gif" {
+		img, err := gocv.IMDecode(data, reducedReadFlag(reduce)|gocv.IMReadIgnoreOrientation)
+		if err == nil && !img.Empty() {
+			return img, nil
+		}
+		img.Close()
+	}
+
+	// GIF 只取第一帧
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return gocv.NewMat(), fmt.Errorf("failed to read image: %w", err)
+	}
+	img, err := imageToBGR(decoded)
+	if err != nil {
+		return img, err
+	}
+	// Go 解码器不支持缩小解码，解码后缩小，与 OpenCV 路径的输出尺寸保持一致
+	reduceMat(&img, reduce)
+	return img, nil
+}
+
+// reducedReadFlag 返回缩小倍数对应的 OpenCV 读取模式
+// JPEG 在 DCT 阶段直接缩小，不会分配全尺寸图像；其他格式由 OpenCV 解码后缩小
+func reducedReadFlag(reduce int) gocv.IMReadFlag {
+	switch reduce {
+	case 2:
+		return gocv.IMReadReducedColor2
+	case 4:
+		return gocv.IMReadReducedColor4
+	case 8:
+		return gocv.IMReadReducedColor8
+	default:
+		return gocv.IMReadColor
+	}
+}
+
+// imageToBGR 将 Go 图像转换为 8 位 BGR Mat，16 位通道取高 8 位，alpha 被丢弃（与 IMReadColor 一致）
+func imageToBGR(img image.Image) (gocv.Mat, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 {
+		return gocv.NewMat(), fmt.Errorf("failed to read image: empty image")
+	}
+
+	data := make([]byte, width*height*3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			i := (y*width + x) * 3
+			data[i] = c.B
+			data[i+1] = c.G
+			data[i+2] = c.R
+		}
+	}
+
+	return gocv.NewMatFromBytes(height, width, gocv.MatTypeCV8UC3, data)
+}
+
+// decodeAlpha 解码图片的透明通道为 8 位单通道图像（存储方向），图片没有透明通道时返回 false
+// 与 decodeStored 使用相同的缩小倍数，返回的透明通道与解码出的图像尺寸一致
+// 带透明通道的格式（PNG、WebP、TIFF）不支持在解码阶段缩小，峰值内存由 max_megapixels 约束
+func decodeAlpha(data []byte) (gocv.Mat, bool) {
+	info := probeImage(data)
+	if info.Channels != 2 && info.Channels != 4 {
+		return gocv.NewMat(), false
+	}
+	reduce, err := checkPixels(info)
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+
+	// IMReadUnchanged 保留 alpha 且不应用 EXIF 方向；灰度 + alpha 的图像交给 Go 解码器
+	img, err := gocv.IMDecode(data, gocv.IMReadUnchanged)
+	if err == nil && img.Channels() == 4 {
+		defer img.Close()
+		channels := gocv.Split(img)
+		for _, ch := range channels[:3] {
+			ch.Close()
+		}
+		alpha := channels[3]
+		if alpha.Type() != gocv.MatTypeCV8U {
+			alpha.ConvertToWithParams(&alpha, gocv.MatTypeCV8U, 1.0/257, 0)
+		}
+		reduceMat(&alpha, reduce)
+		return alpha, true
+	}
+	img.Close()
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+	bounds := decoded.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 {
+		return gocv.NewMat(), false
+	}
+	alphaData := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			alphaData[y*width+x] = color.NRGBAModel.Convert(decoded.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA).A
+		}
+	}
+	alpha, err := gocv.NewMatFromBytes(height, width, gocv.MatTypeCV8U, alphaData)
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+	reduceMat(&alpha, reduce)
+	return alpha, true
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/config"
+)
+
+var (
+	ErrURLNotAllowed = errors.New("url not allowed")
+	ErrFetchTooLarge = errors.New("remote file too large")
+)
+
+// blockedPrefixes IsPrivate/IsLoopback 等方法未覆盖的特殊用途地址段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF 协议分配
+	netip.MustParsePrefix("198.18.0.0/15"), // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),   // 保留
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64，可映射到内网 IPv4
+	netip.MustParsePrefix("2001:db8::/32"), // 文档示例
+}
+
+// ImageFetcher 按 URL 拉取远程图片，防止 SSRF：
+// 限制协议和主机白名单、在建立连接时拒绝内网地址（防止 DNS 重绑定）、逐跳校验重定向，并限制大小和耗时
+type ImageFetcher struct {
+	client         *http.Client
+	allowedHosts   []string
+	allowedSchemes []string
+	maxSize        int64
+}
+
+func NewImageFetcher(cfg *config.FetchConfig, maxSize int64) *ImageFetcher {
+	f := &ImageFetcher{
+		allowedHosts:   cfg.AllowedHosts,
+		allowedSchemes: cfg.AllowedSchemes,
+		maxSize:        maxSize,
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !cfg.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: invalid address %s", ErrURLNotAllowed, address)
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s is not a public address", ErrURLNotAllowed, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // 不使用环境变量中的代理，否则连接检查针对的是代理地址
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("%w: too many redirects", ErrURLNotAllowed)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+
+	return f
+}
+
+// Fetch 拉取 rawURL 指向的文件，返回完整内容；文件类型由调用方按内容识别
+func (f *ImageFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > f.maxSize {
+		return nil, ErrFetchTooLarge
+	}
+
+	// 多读一个字节以判断是否超限，Content-Length 缺失或不实时同样有效
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.maxSize {
+		return nil, ErrFetchTooLarge
+	}
+
+	return data, nil
+}
+
+// checkURL 校验协议、凭据和主机白名单，初始 URL 和每一跳重定向都会经过
+func (f *ImageFetcher) checkURL(u *url.URL) error {
+	if !containsFold(f.allowedSchemes, u.Scheme) {
+		return fmt.Errorf("%w: scheme %q", ErrURLNotAllowed, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in url", ErrURLNotAllowed)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" || !f.hostAllowed(host) {
+		return fmt.Errorf("%w: host %q", ErrURLNotAllowed, host)
+	}
+	return nil
+}
+
+// hostAllowed 白名单为空时拒绝所有主机；"*.example.com" 匹配其子域名但不匹配 example.com 本身
+func (f *ImageFetcher) hostAllowed(host string) bool {
+	for _, allowed := range f.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicAddr 判断地址是否可从公网访问，拒绝回环、私有、链路本地（含云元数据地址）、组播等地址
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// imageInfo 解码前从文件头和元数据段中读取的信息
+type imageInfo struct {
+	Format   string // jpeg, png, webp, gif, bmp, tiff
+	Width    int
+	Height   int
+	BitDepth int    // 每通道位深
+	Channels int    // 通道数
+	Exif     []byte // TIFF 结构的 EXIF 数据
+	ICC      []byte // 嵌入的 ICC 配置文件
+}
+
+// ImageType 根据文件头识别出的图片类型
+type ImageType struct {
+	Format      string // 与 sniffFormat 的返回值一致
+	Ext         string // 保存文件时使用的扩展名
+	ContentType string
+}
+
+var imageTypes = map[string]ImageType{
+	"jpeg": {Format: "jpeg", Ext: ".jpg", ContentType: "image/jpeg"},
+	"png":  {Format: "png", Ext: ".png", ContentType: "image/png"},
+	"webp": {Format: "webp", Ext: ".webp", ContentType: "image/webp"},
+	"gif":  {Format: "gif", Ext: ".gif", ContentType: "image/gif"},
+	"bmp":  {Format: "bmp", Ext: ".bmp", ContentType: "image/bmp"},
+	"tiff": {Format: "tiff", Ext: ".tiff", ContentType: "image/tiff"},
+}
+
+// DetectImageType 根据文件头魔数识别图片类型，不信任客户端声明的类型和文件名
+func DetectImageType(header []byte) (ImageType, bool) {
+	t, ok := imageTypes[sniffFormat(header)]
+	return t, ok
+}
+
+// sniffFormat 根据文件头魔数识别图片格式，无法识别时返回空字符串
+func sniffFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "webp"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "tiff"
+	case isBMP(data):
+		return "bmp"
+	default:
+		return ""
+	}
+}
+
+// probeImage 在不解码像素的情况下读取图片格式、尺寸、位深及 EXIF/ICC 数据
+func probeImage(data []byte) *imageInfo {
+	info := &imageInfo{Format: sniffFormat(data)}
+	switch info.Format {
+	case "jpeg":
+		probeJPEG(data, info)
+	case "png":
+		probePNG(data, info)
+	case "webp":
+		probeWebP(data, info)
+	case "gif":
+		probeGIF(data, info)
+	case "bmp":
+		probeBMP(data, info)
+	case "tiff":
+		probeTIFF(data, info)
+	}
+	return info
+}
+
+// isBMP 检查 "BM" 签名及 DIB 头长度，仅两字节的签名过于宽松
+func isBMP(data []byte) bool {
+	if len(data) < 18 || !bytes.HasPrefix(data, []byte("BM")) {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data[14:]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// probeJPEG 遍历 JPEG 标记段，读取 SOF、APP1(EXIF) 和 APP2(ICC)
+func probeJPEG(data []byte, info *imageInfo) {
+	iccChunks := map[int][]byte{}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			// 与 libjpeg 一致，跳过标记前的无效字节重新同步，否则一个无效字节就能藏住 SOF
+			pos++
+			continue
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++ // 填充字节
+			continue
+		}
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			break // 图像结束或扫描数据开始，之后不再有元数据
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+length]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) && info.Exif == nil:
+			info.Exif = segment[6:]
+		case marker == 0xE2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) && len(segment) > 14:
+			iccChunks[int(segment[12])] = segment[14:]
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			if len(segment) >= 6 {
+				info.BitDepth = int(segment[0])
+				info.Height = int(binary.BigEndian.Uint16(segment[1:]))
+				info.Width = int(binary.BigEndian.Uint16(segment[3:]))
+				info.Channels = int(segment[5])
+			}
+		}
+
+		pos += 2 + length
+	}
+
+	// ICC 配置文件可能拆分在多个 APP2 段中，按序号拼接
+	if len(iccChunks) > 0 {
+		seqs := make([]int, 0, len(iccChunks))
+		for seq := range iccChunks {
+			seqs = append(seqs, seq)
+		}
+		sort.Ints(seqs)
+		for _, seq := range seqs {
+			info.ICC = append(info.ICC, iccChunks[seq]...)
+		}
+	}
+}
+
+// probePNG 遍历 PNG 数据块，读取 IHDR、iCCP 和 eXIf
+func probePNG(data []byte, info *imageInfo) {
+	hasTransparency := false
+	colorType := -1
+
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		chunk := data[pos+8 : pos+8+length]
+
+		switch chunkType {
+		case "IHDR":
+			if len(chunk) >= 10 {
+				info.Width = int(binary.BigEndian.Uint32(chunk[0:]))
+				info.Height = int(binary.BigEndian.Uint32(chunk[4:]))
+				info.BitDepth = int(chunk[8])
+				colorType = int(chunk[9])
+			}
+		case "iCCP":
+			// 配置文件名\0 压缩方式 zlib数据
+			if i := bytes.IndexByte(chunk, 0); i >= 0 && i+2 <= len(chunk) {
+				if r, err := zlib.NewReader(bytes.NewReader(chunk[i+2:])); err == nil {
+					info.ICC, _ = io.ReadAll(io.LimitReader(r, 4<<20))
+					r.Close()
+				}
+			}
+		case "eXIf":
+			info.Exif = chunk
+		case "tRNS":
+			hasTransparency = true
+		case "IDAT", "IEND":
+			pos = len(data)
+			continue
+		}
+
+		pos += 12 + length
+	}
+
+	switch colorType {
+	case 0: // 灰度
+		info.Channels = 1
+	case 2: // RGB
+		info.Channels = 3
+	case 3: // 调色板，解码后为 RGB(A)
+		info.Channels = 3
+	case 4: // 灰度 + alpha
+		info.Channels = 2
+	case 6: // RGBA
+		info.Channels = 4
+	}
+	if hasTransparency && (colorType == 0 || colorType == 2 || colorType == 3) {
+		info.Channels++
+	}
+}
+
+// probeWebP 遍历 RIFF 数据块，读取 VP8/VP8L/VP8X 中的画布尺寸及 ICCP、EXIF 块
+func probeWebP(data []byte, info *imageInfo) {
+	info.BitDepth = 8
+	info.Channels = 3
+
+	pos := 12
+	for pos+8 <= len(data) {
+		fourcc := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if length < 0 || pos+8+length > len(data) {
+			break
+		}
+		chunk := data[pos+8 : pos+8+length]
+
+		switch fourcc {
+		case "VP8X":
+			if len(chunk) >= 10 {
+				if chunk[0]&0x10 != 0 {
+					info.Channels = 4
+				}
+				info.Width = int(uint32(chunk[4])|uint32(chunk[5])<<8|uint32(chunk[6])<<16) + 1
+				info.Height = int(uint32(chunk[7])|uint32(chunk[8])<<8|uint32(chunk[9])<<16) + 1
+			}
+		case "VP8 ":
+			// 帧头：3 字节帧标记，起始码 9d 01 2a，随后为 14 位宽高
+			if len(chunk) >= 10 && info.Width == 0 && bytes.Equal(chunk[3:6], []byte{0x9d, 0x01, 0x2a}) {
+				info.Width = int(binary.LittleEndian.Uint16(chunk[6:]) & 0x3fff)
+				info.Height = int(binary.LittleEndian.Uint16(chunk[8:]) & 0x3fff)
+			}
+		case "VP8L":
+			// 签名 0x2f，随后按位存放 14 位宽-1、14 位高-1 和 1 位 alpha 标记
+			if len(chunk) >= 5 && chunk[0] == 0x2f && info.Width == 0 {
+				bits := binary.LittleEndian.Uint32(chunk[1:])
+				info.Width = int(bits&0x3fff) + 1
+				info.Height = int(bits>>14&0x3fff) + 1
+				if bits>>28&1 != 0 {
+					info.Channels = 4
+				}
+			}
+		case "ICCP":
+			info.ICC = chunk
+		case "EXIF":
+			// 部分编码器会保留 JPEG 的 "Exif\0\0" 前缀
+			info.Exif = bytes.TrimPrefix(chunk, []byte("Exif\x00\x00"))
+		}
+
+		// 数据块按偶数字节对齐
+		pos += 8 + length + length%2
+	}
+}
+
+// probeGIF 读取逻辑屏幕尺寸，GIF 为调色板图像，解码后为 RGB
+func probeGIF(data []byte, info *imageInfo) {
+	if len(data) < 10 {
+		return
+	}
+	info.Width = int(binary.LittleEndian.Uint16(data[6:]))
+	info.Height = int(binary.LittleEndian.Uint16(data[8:]))
+	info.BitDepth = 8
+	info.Channels = 3
+}
+
+// probeBMP 读取 DIB 头中的尺寸和每像素位数
+func probeBMP(data []byte, info *imageInfo) {
+	if binary.LittleEndian.Uint32(data[14:]) == 12 {
+		// BITMAPCOREHEADER：16 位宽高
+		if len(data) < 26 {
+			return
+		}
+		info.Width = int(binary.LittleEndian.Uint16(data[18:]))
+		info.Height = int(binary.LittleEndian.Uint16(data[20:]))
+		info.BitDepth = 8
+		info.Channels = 3
+		return
+	}
+
+	if len(data) < 30 {
+		return
+	}
+	info.Width = int(int32(binary.LittleEndian.Uint32(data[18:])))
+	// 高度为负表示自上而下存储
+	info.Height = abs(int(int32(binary.LittleEndian.Uint32(data[22:]))))
+	info.BitDepth = 8
+	info.Channels = 3
+	if binary.LittleEndian.Uint16(data[28:]) == 32 {
+		info.Channels = 4
+	}
+}
+
+// TIFF 基线标签
+const (
+	tiffTagImageWidth      = 0x0100
+	tiffTagImageLength     = 0x0101
+	tiffTagBitsPerSample   = 0x0102
+	tiffTagSamplesPerPixel = 0x0115
+	tiffTagICCProfile      = 0x8773
+)
+
+// probeTIFF 读取第一个 IFD 的尺寸、位深和 ICC；TIFF 文件本身即 EXIF 所用的 TIFF 结构
+func probeTIFF(data []byte, info *imageInfo) {
+	if len(data) < 8 {
+		return
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		order = binary.BigEndian
+	}
+	ifd0, err := readIFD(data, order, order.Uint32(data[4:8]))
+	if err != nil {
+		return
+	}
+
+	// 缺省值：单通道、1 位（二值图像）
+	info.Exif = data
+	info.BitDepth = 1
+	info.Channels = 1
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tiffTagImageWidth:
+			info.Width = int(e.number(order))
+		case tiffTagImageLength:
+			info.Height = int(e.number(order))
+		case tiffTagBitsPerSample:
+			info.BitDepth = int(e.number(order))
+		case tiffTagSamplesPerPixel:
+			info.Channels = int(e.number(order))
+		case tiffTagICCProfile:
+			info.ICC = e.value
+		}
+	}
+}
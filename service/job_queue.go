@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/utils"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrJobNotFound 任务不存在或已过期
+	ErrJobNotFound = errors.New("job not found")
+	// ErrQueueFull 排队任务数达到 jobs.max_queue
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+const (
+	jobQueueKey = "jobs:queue"
+	// jobPollTimeout 工作协程阻塞等待新任务的时长
+	jobPollTimeout = 5 * time.Second
+)
+
+// submitScript 检查队列长度并写入图片、任务状态和队列，整体原子执行，并发提交不会超出 max_queue
+// KEYS: 队列、任务状态、图片；ARGV: 队列上限（0 不限制）、任务状态、图片、保留时长（毫秒，0 不过期）、任务 ID
+var submitScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+if limit > 0 and redis.call('LLEN', KEYS[1]) >= limit then
+	return 0
+end
+local ttl = tonumber(ARGV[4])
+if ttl > 0 then
+	redis.call('SET', KEYS[3], ARGV[3], 'PX', ttl)
+	redis.call('SET', KEYS[2], ARGV[2], 'PX', ttl)
+else
+	redis.call('SET', KEYS[3], ARGV[3])
+	redis.call('SET', KEYS[2], ARGV[2])
+end
+redis.call('RPUSH', KEYS[1], ARGV[5])
+return 1
+`)
+
+// JobFunc 执行一个任务，返回分层结果及是否来自缓存；失败时返回与同步接口相同的错误响应
+type JobFunc func(ctx context.Context, data []byte, md5 string, opts ProcessOptions) (*model.LayerResult, bool, *model.ErrorResponse)
+
+// jobRecord Redis 中保存的任务，Options 供执行任务的实例使用，不返回给客户端
+type jobRecord struct {
+	model.Job
+	Options ProcessOptions `json:"options"`
+}
+
+// JobQueue 基于 Redis 的异步任务队列
+// 任务状态（job:<id>）、排队中的图片（job:<id>:image）和先进先出的队列（jobs:queue）都保存在 Redis 中，
+// 任一实例都能查询状态和排队位置，也都可以执行任务。工作协程取出任务时原子地移入自己的处理中列表
+// （jobs:processing:<instance>:<n>），完成后移除；实例中途退出时，重启后将其中的任务放回队列
+type JobQueue struct {
+	client   *redis.Client
+	maxQueue int64
+	ttl      time.Duration
+	instance string
+}
+
+func NewJobQueue(redisService *RedisService, cfg *config.JobsConfig) *JobQueue {
+	instance := cfg.InstanceID
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	return &JobQueue{
+		client:   redisService.client,
+		maxQueue: int64(cfg.MaxQueue),
+		ttl:      cfg.TTL,
+		instance: instance,
+	}
+}
+
+// Submit 保存图片和任务状态，并将任务加入队列末尾
+func (q *JobQueue) Submit(ctx context.Context, data []byte, md5 string, opts ProcessOptions) (*model.Job, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	rec := &jobRecord{
+		Job: model.Job{
+			ID:        id,
+			Status:    model.JobQueued,
+			MD5:       md5,
+			CreatedAt: time.Now().Unix(),
+		},
+		Options: opts,
+	}
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// 图片和状态先于队列写入，工作协程取到 ID 时两者都已存在
+	keys := []string{jobQueueKey, jobKey(id), jobImageKey(id)}
+	added, err := submitScript.Run(ctx, q.client, keys, q.maxQueue, payload, data, q.ttl.Milliseconds(), id).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit job: %w", err)
+	}
+	if added == 0 {
+		return nil, ErrQueueFull
+	}
+
+	job := rec.Job
+	job.QueuePosition = q.position(ctx, id)
+	return &job, nil
+}
+
+// Get 读取任务状态，排队中的任务附带排队位置
+func (q *JobQueue) Get(ctx context.Context, id string) (*model.Job, error) {
+	if !isHex32(id) {
+		return nil, ErrJobNotFound
+	}
+	rec, err := q.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job := rec.Job
+	if job.Status == model.JobQueued {
+		job.QueuePosition = q.position(ctx, id)
+	}
+	return &job, nil
+}
+
+// Start 将本实例上次退出时未完成的任务放回队列，然后启动 workers 个工作协程，从队列中依次取出任务交给 run 执行
+func (q *JobQueue) Start(workers int, run JobFunc) {
+	if workers <= 0 {
+		return
+	}
+	ctx := context.Background()
+	if err := q.requeue(ctx); err != nil {
+		utils.Logger.Warn("failed to requeue unfinished jobs", zap.Error(err))
+	}
+	for i := 0; i < workers; i++ {
+		go q.work(q.processingKey(i), run)
+	}
+}
+
+// requeue 将本实例各处理中列表里的任务放回队列头部并恢复为排队状态，工作协程数变化后遗留的列表同样处理
+func (q *JobQueue) requeue(ctx context.Context) error {
+	iter := q.client.Scan(ctx, 0, q.processingKey(-1)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		processing := iter.Val()
+		for {
+			id, err := q.client.LMove(ctx, processing, jobQueueKey, "RIGHT", "LEFT").Result()
+			if errors.Is(err, redis.Nil) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			rec, err := q.load(ctx, id)
+			if err != nil {
+				// 任务已过期，执行时会跳过
+				continue
+			}
+			rec.Status = model.JobQueued
+			rec.StartedAt = 0
+			if err := q.save(ctx, rec, redis.KeepTTL); err != nil {
+				return err
+			}
+			utils.Logger.Info("unfinished job requeued", zap.String("id", id))
+		}
+	}
+	return iter.Err()
+}
+
+// work 工作协程主循环，取出的任务在完成前一直保留在 processing 列表中
+func (q *JobQueue) work(processing string, run JobFunc) {
+	ctx := context.Background()
+	failing := false
+	for {
+		id, err := q.client.BLMove(ctx, jobQueueKey, processing, "LEFT", "RIGHT", jobPollTimeout).Result()
+		if errors.Is(err, redis.Nil) {
+			failing = false
+			continue
+		}
+		if err != nil {
+			// Redis 不可用时只在首次失败时记录，避免刷屏
+			if !failing {
+				utils.Logger.Warn("failed to poll job queue", zap.Error(err))
+				failing = true
+			}
+			time.Sleep(jobPollTimeout)
+			continue
+		}
+		failing = false
+		q.execute(ctx, id, run)
+		if err := q.client.LRem(ctx, processing, 1, id).Err(); err != nil {
+			utils.Logger.Warn("failed to remove finished job from processing list", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// execute 执行一个已出队的任务，结果或错误写回任务状态，并从完成时起重新计算保留时长
+func (q *JobQueue) execute(ctx context.Context, id string, run JobFunc) {
+	rec, err := q.load(ctx, id)
+	if err != nil {
+		utils.Logger.Warn("dequeued job unavailable", zap.String("id", id), zap.Error(err))
+		return
+	}
+	defer q.client.Del(ctx, jobImageKey(id))
+
+	data, err := q.client.Get(ctx, jobImageKey(id)).Bytes()
+	if err != nil {
+		q.finish(ctx, rec, nil, false, &model.ErrorResponse{
+			Success: false,
+			Message: "任务图片已过期",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rec.Status = model.JobRunning
+	rec.StartedAt = time.Now().Unix()
+	if err := q.save(ctx, rec, redis.KeepTTL); err != nil {
+		utils.Logger.Warn("failed to update job", zap.String("id", id), zap.Error(err))
+	}
+
+	result, cached, errResp := q.run(ctx, run, data, rec)
+	q.finish(ctx, rec, result, cached, errResp)
+}
+
+// run 执行任务，处理过程中的 panic 记录为任务失败，不影响工作协程
+func (q *JobQueue) run(ctx context.Context, run JobFunc, data []byte, rec *jobRecord) (result *model.LayerResult, cached bool, errResp *model.ErrorResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.Logger.Error("job panicked", zap.String("id", rec.ID), zap.Any("panic", r))
+			result, cached = nil, false
+			errResp = &model.ErrorResponse{
+				Success: false,
+				Message: "图片处理失败",
+				Error:   fmt.Sprint(r),
+			}
+		}
+	}()
+	return run(ctx, data, rec.MD5, rec.Options)
+}
+
+func (q *JobQueue) finish(ctx context.Context, rec *jobRecord, result *model.LayerResult, cached bool, errResp *model.ErrorResponse) {
+	rec.FinishedAt = time.Now().Unix()
+	if errResp != nil {
+		rec.Status = model.JobFailed
+		rec.Error = errResp
+	} else {
+		rec.Status = model.JobDone
+		rec.Result = result
+		rec.Cached = cached
+	}
+	if err := q.save(ctx, rec, q.ttl); err != nil {
+		utils.Logger.Error("failed to save job result", zap.String("id", rec.ID), zap.Error(err))
+		return
+	}
+
+	utils.Logger.Info("job finished",
+		zap.String("id", rec.ID),
+		zap.String("md5", rec.MD5),
+		zap.String("status", rec.Status))
+}
+
+func (q *JobQueue) load(ctx context.Context, id string) (*jobRecord, error) {
+	payload, err := q.client.Get(ctx, jobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %w", err)
+	}
+
+	var rec jobRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &rec, nil
+}
+
+func (q *JobQueue) save(ctx context.Context, rec *jobRecord, ttl time.Duration) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return q.client.Set(ctx, jobKey(rec.ID), payload, ttl).Err()
+}
+
+// position 返回任务在队列中的位置（1 为下一个执行），不在队列中时返回 0
+func (q *JobQueue) position(ctx context.Context, id string) int {
+	index, err := q.client.LPos(ctx, jobQueueKey, id, redis.LPosArgs{}).Result()
+	if err != nil {
+		// 已被取出但尚未标记为处理中，或查询失败
+		return 0
+	}
+	return int(index) + 1
+}
+
+// processingKey 返回本实例第 n 个工作协程的处理中列表，n 为负数时返回不含序号的前缀
+func (q *JobQueue) processingKey(n int) string {
+	prefix := "jobs:processing:" + q.instance + ":"
+	if n < 0 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(n)
+}
+
+func jobKey(id string) string {
+	return "job:" + id
+}
+
+func jobImageKey(id string) string {
+	return "job:" + id + ":image"
+}
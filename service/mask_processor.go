@@ -140,3 +140,30 @@ func (mp *MaskProcessor) checkNeighborhood(mask *gocv.Mat, x, y int) bool {
 	}
 	return count > 12
 }
+
+// Feather 羽化掩码边缘，返回 0-255 的软边缘 alpha
+func (mp *MaskProcessor) Feather(mask *gocv.Mat, radius int) gocv.Mat {
+	if radius <= 0 {
+		return mask.Clone()
+	}
+
+	feathered := gocv.NewMat()
+	gocv.GaussianBlur(*mask, &feathered, image.Point{X: radius*2 + 1, Y: radius*2 + 1}, 0, 0, gocv.BorderDefault)
+
+	return feathered
+}
+
+// Expand 按半径向外扩展掩码
+func (mp *MaskProcessor) Expand(mask *gocv.Mat, radius int) gocv.Mat {
+	if radius <= 0 {
+		return mask.Clone()
+	}
+
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Point{X: radius*2 + 1, Y: radius*2 + 1})
+	defer kernel.Close()
+
+	expanded := gocv.NewMat()
+	gocv.Dilate(*mask, &expanded, kernel)
+
+	return expanded
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/TIANLI0/LayerKit/model"
+)
+
+// MetadataExtractor 负责在 OpenCV 解码前提取原图的格式和元数据
+type MetadataExtractor struct {
+	keepGPS bool
+}
+
+func NewMetadataExtractor(keepGPS bool) *MetadataExtractor {
+	return &MetadataExtractor{
+		keepGPS: keepGPS,
+	}
+}
+
+// Extract 从原始文件数据中提取格式、位深、通道数、EXIF、ICC 配置文件和哈希
+// GPS 位置属于隐私信息，除非配置允许否则不返回
+func (me *MetadataExtractor) Extract(data []byte, md5 string) *model.ImageMetadata {
+	info := probeImage(data)
+	sum := sha256.Sum256(data)
+
+	meta := &model.ImageMetadata{
+		Format:   info.Format,
+		FileSize: int64(len(data)),
+		BitDepth: info.BitDepth,
+		Channels: info.Channels,
+		MD5:      md5,
+		SHA256:   hex.EncodeToString(sum[:]),
+	}
+
+	if len(info.ICC) > 0 {
+		meta.ICCProfile = iccProfileName(info.ICC)
+	}
+
+	if len(info.Exif) > 0 {
+		if exif, err := parseExif(info.Exif); err == nil {
+			meta.Orientation = exif.Orientation
+			meta.CameraMake = exif.Make
+			meta.CameraModel = exif.Model
+			meta.CaptureTime = exif.DateTimeOriginal
+			if meta.CaptureTime == "" {
+				meta.CaptureTime = exif.DateTime
+			}
+			if me.keepGPS && exif.HasGPS {
+				meta.GPS = &model.GPS{Latitude: exif.Latitude, Longitude: exif.Longitude}
+			}
+		}
+	}
+
+	return meta
+}
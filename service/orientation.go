@@ -0,0 +1,85 @@
+package service
+
+import (
+	"gocv.io/x/gocv"
+)
+
+// 掩码和坐标所在的方向
+const (
+	OrientationUpright = "upright" // 按 EXIF Orientation 转正后的方向，与浏览器显示一致
+	OrientationStored  = "stored"  // 文件中像素的存储方向
+)
+
+// orientationTransforms EXIF Orientation 值（1-8）对应的转正变换
+var orientationTransforms = map[int]string{
+	1: "none",
+	2: "flip_horizontal",
+	3: "rotate_180",
+	4: "flip_vertical",
+	5: "transpose",
+	6: "rotate_90_cw",
+	7: "transverse",
+	8: "rotate_90_ccw",
+}
+
+// exifOrientation 读取图片的 EXIF Orientation，无标签或值非法时返回 1
+func exifOrientation(data []byte) int {
+	info := probeImage(data)
+	if len(info.Exif) == 0 {
+		return 1
+	}
+	exif, err := parseExif(info.Exif)
+	if err != nil || orientationTransforms[exif.Orientation] == "" {
+		return 1
+	}
+	return exif.Orientation
+}
+
+// orientUpright 将存储方向的图像按 EXIF Orientation 转正（原地替换）
+func orientUpright(img *gocv.Mat, orientation int) {
+	switch orientation {
+	case 2:
+		gocv.Flip(*img, img, 1)
+	case 3:
+		gocv.Rotate(*img, img, gocv.Rotate180Clockwise)
+	case 4:
+		gocv.Flip(*img, img, 0)
+	case 5:
+		transposeMat(img)
+	case 6:
+		rotateMat(img, gocv.Rotate90Clockwise)
+	case 7:
+		transposeMat(img)
+		gocv.Flip(*img, img, -1)
+	case 8:
+		rotateMat(img, gocv.Rotate90CounterClockwise)
+	}
+}
+
+// orientStored orientUpright 的逆变换，将正向的图像（如掩码）变换回存储方向
+// 除 90° 旋转外其余变换均为自身的逆
+func orientStored(img *gocv.Mat, orientation int) {
+	switch orientation {
+	case 6:
+		rotateMat(img, gocv.Rotate90CounterClockwise)
+	case 8:
+		rotateMat(img, gocv.Rotate90Clockwise)
+	default:
+		orientUpright(img, orientation)
+	}
+}
+
+// rotateMat 和 transposeMat 会改变宽高，不能原地操作
+func rotateMat(img *gocv.Mat, code gocv.RotateFlag) {
+	rotated := gocv.NewMat()
+	gocv.Rotate(*img, &rotated, code)
+	img.Close()
+	*img = rotated
+}
+
+func transposeMat(img *gocv.Mat) {
+	transposed := gocv.NewMat()
+	gocv.Transpose(*img, &transposed)
+	img.Close()
+	*img = transposed
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/utils"
+	"go.uber.org/zap"
+)
+
+// ErrOriginalNotFound 没有保留该 MD5 的原图（未保留、已过期或已被淘汰）
+var ErrOriginalNotFound = errors.New("original not found")
+
+type originalEntry struct {
+	md5      string
+	path     string
+	size     int64
+	accessed time.Time
+}
+
+// OriginalStore 按内容 MD5 保留原图，路径为 <dir>/<md5[0:2]>/<md5[2:4]>/<md5><ext>
+// 有效期按最后一次访问计算；总大小超过配额时淘汰最久未访问的原图
+// 访问时刷新文件的修改时间，重启后按修改时间重建索引，淘汰顺序不变
+type OriginalStore struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // 值为 *originalEntry
+	lru     *list.List               // 队首为最近访问
+	total   int64
+}
+
+func NewOriginalStore(cfg *config.RetentionConfig) (*OriginalStore, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create retention dir: %w", err)
+	}
+	s := &OriginalStore{
+		dir:     cfg.Dir,
+		ttl:     cfg.TTL,
+		maxSize: cfg.MaxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("failed to index retained originals: %w", err)
+	}
+	s.mu.Lock()
+	s.evictLocked()
+	s.mu.Unlock()
+	return s, nil
+}
+
+// load 扫描目录重建索引，清理中断写入留下的临时文件
+func (s *OriginalStore) load() error {
+	var found []*originalEntry
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		if strings.HasPrefix(name, ".tmp-") {
+			os.Remove(path)
+			return nil
+		}
+		md5 := strings.TrimSuffix(name, filepath.Ext(name))
+		if !isHex32(md5) || filepath.Dir(path) != s.shardDir(md5) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		found = append(found, &originalEntry{md5: md5, path: path, size: info.Size(), accessed: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].accessed.Before(found[j].accessed) })
+	for _, entry := range found {
+		if _, ok := s.entries[entry.md5]; ok {
+			// 同一 MD5 存在不同扩展名的文件时只保留最近的一个
+			s.removeLocked(s.entries[entry.md5])
+		}
+		s.entries[entry.md5] = s.lru.PushFront(entry)
+		s.total += entry.size
+	}
+	return nil
+}
+
+// Put 保留原图，已存在时只刷新访问时间；ext 为识别出的扩展名（含点）
+// 单张超过配额的图片不保留
+func (s *OriginalStore) Put(md5 string, data []byte, ext string) error {
+	md5 = strings.ToLower(md5)
+	if !isHex32(md5) {
+		return fmt.Errorf("%w: invalid md5 %q", ErrInvalidParam, md5)
+	}
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return nil
+	}
+
+	s.mu.Lock()
+	if el, ok := s.entries[md5]; ok {
+		s.touchLocked(el)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	// 写入在锁外进行，先写临时文件再重命名，读取方不会看到不完整的文件
+	dir := s.shardDir(md5)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to retain original: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to retain original: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	path := filepath.Join(dir, md5+ext)
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to retain original: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.entries[md5]; ok {
+		// 并发保留了同一张图片
+		s.touchLocked(el)
+		return nil
+	}
+	s.entries[md5] = s.lru.PushFront(&originalEntry{md5: md5, path: path, size: int64(len(data)), accessed: time.Now()})
+	s.total += int64(len(data))
+	s.evictLocked()
+	return nil
+}
+
+// Get 读取保留的原图并刷新访问时间
+func (s *OriginalStore) Get(md5 string) ([]byte, error) {
+	md5 = strings.ToLower(md5)
+	s.mu.Lock()
+	el, ok := s.entries[md5]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrOriginalNotFound
+	}
+	if s.expired(el.Value.(*originalEntry), time.Now()) {
+		s.removeLocked(el)
+		s.mu.Unlock()
+		return nil, ErrOriginalNotFound
+	}
+	s.touchLocked(el)
+	path := el.Value.(*originalEntry).path
+	s.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// 文件在索引之外被删除
+		s.mu.Lock()
+		if el, ok := s.entries[md5]; ok {
+			s.removeLocked(el)
+		}
+		s.mu.Unlock()
+		return nil, ErrOriginalNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original: %w", err)
+	}
+	return data, nil
+}
+
+// Cleanup 删除已过期的原图，返回删除的数量
+func (s *OriginalStore) Cleanup() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	now := time.Now()
+	for el := s.lru.Back(); el != nil && s.expired(el.Value.(*originalEntry), now); el = s.lru.Back() {
+		s.removeLocked(el)
+		removed++
+	}
+	return removed
+}
+
+// StartCleanup 在后台按 interval 定期清理过期的原图
+func (s *OriginalStore) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if removed := s.Cleanup(); removed > 0 {
+				utils.Logger.Info("expired originals removed", zap.Int("count", removed))
+			}
+		}
+	}()
+}
+
+func (s *OriginalStore) expired(entry *originalEntry, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(entry.accessed) > s.ttl
+}
+
+// evictLocked 超出配额时从最久未访问的原图开始淘汰
+func (s *OriginalStore) evictLocked() {
+	for s.maxSize > 0 && s.total > s.maxSize && s.lru.Len() > 0 {
+		s.removeLocked(s.lru.Back())
+	}
+}
+
+func (s *OriginalStore) touchLocked(el *list.Element) {
+	entry := el.Value.(*originalEntry)
+	entry.accessed = time.Now()
+	s.lru.MoveToFront(el)
+	os.Chtimes(entry.path, entry.accessed, entry.accessed)
+}
+
+func (s *OriginalStore) removeLocked(el *list.Element) {
+	entry := s.lru.Remove(el).(*originalEntry)
+	delete(s.entries, entry.md5)
+	s.total -= entry.size
+	if err := os.Remove(entry.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		utils.Logger.Warn("failed to delete original",
+			zap.String("file", entry.path),
+			zap.Error(err))
+	}
+}
+
+func (s *OriginalStore) shardDir(md5 string) string {
+	return filepath.Join(s.dir, md5[0:2], md5[2:4])
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// MaxContactSheetTiles 联系表最多包含的格数
+const MaxContactSheetTiles = 100
+
+var (
+	// overlayColors 各类型图层的着色，未列出的类型依次使用 overlayPalette
+	overlayColors = map[string]color.RGBA{
+		"foreground": {R: 46, G: 204, B: 64, A: 255},
+		"background": {R: 0, G: 116, B: 217, A: 255},
+	}
+	overlayPalette = []color.RGBA{
+		{R: 255, G: 65, B: 54, A: 255},
+		{R: 177, G: 13, B: 201, A: 255},
+		{R: 255, G: 133, B: 27, A: 255},
+	}
+	faceColor     = color.RGBA{R: 255, G: 220, B: 0, A: 255}
+	labelColor    = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	neutralCanvas = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	sheetCanvas   = color.RGBA{R: 32, G: 32, B: 32, A: 255}
+)
+
+// OverlaySpec QA 叠加预览参数
+type OverlaySpec struct {
+	Opacity float64 // 掩码着色的不透明度
+	MaxSize int     // 输出图像长边上限
+	Faces   bool    // 是否标出检测到的人脸（需要原图）
+}
+
+// ContactSheetSpec 联系表参数
+type ContactSheetSpec struct {
+	Columns  int
+	TileSize int // 每格边长
+	Overlay  OverlaySpec
+}
+
+// OverlayTile 联系表中的一格；Result 为 nil 表示未找到分层结果
+type OverlayTile struct {
+	Label  string
+	Result *model.LayerResult
+	// LoadImage 渲染该格时读取原图，渲染完即释放，不同时持有所有原图；为 nil 或返回空数据时使用灰画布
+	LoadImage func() ([]byte, error)
+}
+
+// OverlayRenderer 将分层结果以着色掩码、轮廓和边界框叠加到原图上，用于人工质检
+type OverlayRenderer struct {
+	portraitDetector *PortraitDetector
+}
+
+func NewOverlayRenderer() *OverlayRenderer {
+	return &OverlayRenderer{
+		portraitDetector: NewPortraitDetector(),
+	}
+}
+
+// Render 渲染单张叠加预览，输出 JPEG；imageData 为空时叠加在中性灰画布上
+func (ov *OverlayRenderer) Render(imageData []byte, result *model.LayerResult, spec OverlaySpec) ([]byte, string, error) {
+	if err := validateOverlaySpec(spec); err != nil {
+		return nil, "", err
+	}
+
+	canvas, err := ov.draw(imageData, result, spec)
+	if err != nil {
+		return nil, "", err
+	}
+	defer canvas.Close()
+
+	return encodeImage(&canvas, "jpg")
+}
+
+// ContactSheet 将多张叠加预览按网格拼接为一张图，每格下方标注标签
+func (ov *OverlayRenderer) ContactSheet(tiles []OverlayTile, spec ContactSheetSpec) ([]byte, string, error) {
+	if len(tiles) == 0 || len(tiles) > MaxContactSheetTiles {
+		return nil, "", fmt.Errorf("%w: tile count must be in [1, %d]", ErrInvalidParam, MaxContactSheetTiles)
+	}
+	if spec.Columns < 1 || spec.Columns > 20 {
+		return nil, "", fmt.Errorf("%w: columns must be in [1, 20]", ErrInvalidParam)
+	}
+	if spec.TileSize < 64 || spec.TileSize > 1024 {
+		return nil, "", fmt.Errorf("%w: tile size must be in [64, 1024]", ErrInvalidParam)
+	}
+	spec.Overlay.MaxSize = spec.TileSize
+	if err := validateOverlaySpec(spec.Overlay); err != nil {
+		return nil, "", err
+	}
+
+	const gap, labelHeight = 4, 20
+	columns := min(spec.Columns, len(tiles))
+	rows := (len(tiles) + columns - 1) / columns
+	cellW, cellH := spec.TileSize+gap, spec.TileSize+labelHeight+gap
+
+	sheet := solidMat(columns*cellW+gap, rows*cellH+gap, sheetCanvas)
+	defer sheet.Close()
+
+	for i, tile := range tiles {
+		origin := image.Point{X: gap + (i%columns)*cellW, Y: gap + (i/columns)*cellH}
+		label := tile.Label
+
+		if tile.Result != nil {
+			if err := ov.placeTile(&sheet, tile, spec, origin); err != nil {
+				label += " (error)"
+			}
+		} else {
+			label += " (not found)"
+		}
+
+		gocv.PutText(&sheet, label,
+			image.Point{X: origin.X + 2, Y: origin.Y + spec.TileSize + labelHeight - 6},
+			gocv.FontHersheySimplex, 0.45, labelColor, 1)
+	}
+
+	return encodeImage(&sheet, "jpg")
+}
+
+// placeTile 渲染一格叠加预览并居中放入联系表
+func (ov *OverlayRenderer) placeTile(sheet *gocv.Mat, tile OverlayTile, spec ContactSheetSpec, origin image.Point) error {
+	var imageData []byte
+	if tile.LoadImage != nil {
+		data, err := tile.LoadImage()
+		if err != nil {
+			return err
+		}
+		imageData = data
+	}
+
+	canvas, err := ov.draw(imageData, tile.Result, spec.Overlay)
+	if err != nil {
+		return err
+	}
+	defer canvas.Close()
+
+	fitted, err := fitMat(&canvas, spec.TileSize, spec.TileSize, "contain", sheetCanvas)
+	if err != nil {
+		return err
+	}
+	defer fitted.Close()
+
+	region := sheet.Region(image.Rectangle{Min: origin, Max: origin.Add(image.Point{X: spec.TileSize, Y: spec.TileSize})})
+	defer region.Close()
+	fitted.CopyTo(&region)
+
+	return nil
+}
+
+// draw 在原图（或中性灰画布）上绘制各图层的着色掩码、轮廓、边界框和人脸框
+func (ov *OverlayRenderer) draw(imageData []byte, result *model.LayerResult, spec OverlaySpec) (gocv.Mat, error) {
+	if result.Width <= 0 || result.Height <= 0 {
+		return gocv.NewMat(), fmt.Errorf("invalid result size %dx%d", result.Width, result.Height)
+	}
+
+	// 直接以预览尺寸解码和绘制，之后的所有坐标按 scale 换算
+	scale := math.Min(1, float64(spec.MaxSize)/float64(max(result.Width, result.Height)))
+	size := image.Point{
+		X: max(1, int(math.Round(float64(result.Width)*scale))),
+		Y: max(1, int(math.Round(float64(result.Height)*scale))),
+	}
+
+	var canvas gocv.Mat
+	var faces []image.Rectangle
+	if len(imageData) > 0 {
+		upright := result.Orientation == nil || result.Orientation.Output != OrientationStored
+		img, err := decodePreview(imageData, upright, max(size.X, size.Y))
+		if err != nil {
+			return gocv.NewMat(), err
+		}
+		if img.Cols() != size.X || img.Rows() != size.Y {
+			gocv.Resize(img, &img, size, 0, 0, gocv.InterpolationArea)
+		}
+		// 人脸在预览图上检测，坐标已是预览尺寸
+		if spec.Faces {
+			faces = ov.portraitDetector.DetectFace(&img)
+		}
+		canvas = img
+	} else {
+		canvas = solidMat(size.X, size.Y, neutralCanvas)
+	}
+
+	scaleRect := func(r image.Rectangle) image.Rectangle {
+		return image.Rect(
+			int(math.Round(float64(r.Min.X)*scale)), int(math.Round(float64(r.Min.Y)*scale)),
+			int(math.Round(float64(r.Max.X)*scale)), int(math.Round(float64(r.Max.Y)*scale)))
+	}
+
+	for i, layer := range result.Layers {
+		c, ok := overlayColors[layer.Type]
+		if !ok {
+			c = overlayPalette[i%len(overlayPalette)]
+		}
+		if err := ov.drawLayer(&canvas, layer, c, spec.Opacity); err != nil {
+			canvas.Close()
+			return gocv.NewMat(), err
+		}
+
+		bbox := scaleRect(image.Rect(layer.BoundingBox.X, layer.BoundingBox.Y,
+			layer.BoundingBox.X+layer.BoundingBox.Width, layer.BoundingBox.Y+layer.BoundingBox.Height))
+		if bbox.Empty() {
+			continue
+		}
+		gocv.Rectangle(&canvas, bbox, c, 2)
+		gocv.PutText(&canvas, fmt.Sprintf("%s %.2f", layer.Type, layer.Confidence),
+			image.Point{X: bbox.Min.X + 4, Y: bbox.Min.Y + 18},
+			gocv.FontHersheySimplex, 0.5, c, 1)
+	}
+
+	for _, face := range faces {
+		gocv.Rectangle(&canvas, face, faceColor, 2)
+	}
+
+	return canvas, nil
+}
+
+// drawLayer 按 opacity 将图层掩码区域着色，并描出掩码外轮廓
+func (ov *OverlayRenderer) drawLayer(canvas *gocv.Mat, layer model.Layer, c color.RGBA, opacity float64) error {
+	mask, err := decodeMask(layer.Mask, canvas.Cols(), canvas.Rows())
+	if err != nil {
+		return err
+	}
+	defer mask.Close()
+
+	alpha := gocv.NewMat()
+	defer alpha.Close()
+	mask.ConvertToWithParams(&alpha, gocv.MatTypeCV8U, float32(opacity), 0)
+
+	tint := solidMat(canvas.Cols(), canvas.Rows(), c)
+	defer tint.Close()
+	alphaBlend(canvas, &tint, &alpha, image.Point{})
+
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+	gocv.DrawContours(canvas, contours, -1, c, 2)
+
+	return nil
+}
+
+func validateOverlaySpec(spec OverlaySpec) error {
+	if spec.Opacity < 0 || spec.Opacity > 1 {
+		return fmt.Errorf("%w: opacity must be in [0, 1]", ErrInvalidParam)
+	}
+	if spec.MaxSize < 64 || spec.MaxSize > 4096 {
+		return fmt.Errorf("%w: max size must be in [64, 4096]", ErrInvalidParam)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// PipelineTrace 记录处理管线各阶段的中间结果和耗时，仅在调试模式下生成
+// 零值不可用，需通过 TraceImage 获得；nil 上的记录调用会被忽略，管线无需判断是否开启调试
+type PipelineTrace struct {
+	Complexity ComplexityInfo
+	Scale      float64
+	Stages     []TraceStage
+
+	start time.Time
+	last  time.Time
+}
+
+// TraceStage 一个管线阶段的记录
+type TraceStage struct {
+	Name     string
+	Duration time.Duration    // 自上一阶段结束以来的耗时
+	Image    []byte           // 该阶段产物的 PNG 编码，无图像产物时为空
+	Rect     *image.Rectangle // 该阶段产出的矩形（如 GrabCut 初始矩形）
+}
+
+func newPipelineTrace() *PipelineTrace {
+	now := time.Now()
+	return &PipelineTrace{start: now, last: now}
+}
+
+// record 记录一个阶段结束，mat 为该阶段的产物（可为 nil）
+func (t *PipelineTrace) record(name string, mat *gocv.Mat) {
+	if t == nil {
+		return
+	}
+	stage := TraceStage{Name: name, Duration: time.Since(t.last)}
+	if mat != nil && !mat.Empty() {
+		stage.Image = encodeTraceImage(mat)
+	}
+	t.Stages = append(t.Stages, stage)
+	// 编码耗时不计入下一阶段
+	t.last = time.Now()
+}
+
+// recordGrabCutMask 记录 GrabCut 掩码，0-3 的标签值按 85 倍拉伸以便查看
+func (t *PipelineTrace) recordGrabCutMask(name string, mask *gocv.Mat) {
+	if t == nil {
+		return
+	}
+	if mask.Empty() {
+		t.record(name, nil)
+		return
+	}
+	visible := gocv.NewMat()
+	defer visible.Close()
+	mask.ConvertToWithParams(&visible, gocv.MatTypeCV8U, 85, 0)
+	t.record(name, &visible)
+}
+
+// recordRect 记录以矩形为产物的阶段，并在图像上画出该矩形
+func (t *PipelineTrace) recordRect(name string, img *gocv.Mat, rect image.Rectangle) {
+	if t == nil {
+		return
+	}
+	preview := img.Clone()
+	defer preview.Close()
+	gocv.Rectangle(&preview, rect, color.RGBA{R: 255, A: 255}, 2)
+	t.record(name, &preview)
+	t.Stages[len(t.Stages)-1].Rect = &rect
+}
+
+func encodeTraceImage(mat *gocv.Mat) []byte {
+	buf, err := gocv.IMEncode(gocv.PNGFileExt, *mat)
+	if err != nil {
+		return nil
+	}
+	defer buf.Close()
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.GetBytes())
+	return data
+}
+
+// traceManifest trace.json 的结构
+type traceManifest struct {
+	MD5             string          `json:"md5"`
+	PipelineVersion int             `json:"pipeline_version"`
+	Complexity      traceComplexity `json:"complexity"`
+	Scale           float64         `json:"scale"`
+	TotalMs         float64         `json:"total_ms"`
+	Stages          []traceEntry    `json:"stages"`
+}
+
+type traceComplexity struct {
+	Level         string  `json:"level"`
+	EdgeDensity   float64 `json:"edge_density"`
+	ColorVariance float64 `json:"color_variance"`
+	IsPortrait    bool    `json:"is_portrait"`
+}
+
+type traceEntry struct {
+	Name       string      `json:"name"`
+	DurationMs float64     `json:"duration_ms"`
+	File       string      `json:"file,omitempty"`
+	Rect       *model.BBox `json:"rect,omitempty"`
+}
+
+// Bundle 将分层结果和各阶段产物打包为 ZIP：result.json、trace.json 及 stages/ 下按顺序编号的 PNG
+func (t *PipelineTrace) Bundle(result *model.LayerResult) ([]byte, error) {
+	manifest := traceManifest{
+		MD5:             result.MD5,
+		PipelineVersion: result.PipelineVersion,
+		Complexity: traceComplexity{
+			Level:         t.Complexity.Level,
+			EdgeDensity:   t.Complexity.EdgeDensity,
+			ColorVariance: t.Complexity.ColorVariance,
+			IsPortrait:    t.Complexity.IsPortrait,
+		},
+		Scale:   t.Scale,
+		TotalMs: durationMs(t.last.Sub(t.start)),
+		Stages:  make([]traceEntry, 0, len(t.Stages)),
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for i, stage := range t.Stages {
+		entry := traceEntry{Name: stage.Name, DurationMs: durationMs(stage.Duration)}
+		if stage.Rect != nil {
+			entry.Rect = &model.BBox{X: stage.Rect.Min.X, Y: stage.Rect.Min.Y, Width: stage.Rect.Dx(), Height: stage.Rect.Dy()}
+		}
+		if len(stage.Image) > 0 {
+			entry.File = fmt.Sprintf("stages/%02d_%s.png", i+1, stage.Name)
+			if err := writeZipFile(zw, entry.File, stage.Image); err != nil {
+				return nil, err
+			}
+		}
+		manifest.Stages = append(manifest.Stages, entry)
+	}
+
+	files := []struct {
+		name  string
+		value any
+	}{
+		{"result.json", result},
+		{"trace.json", manifest},
+	}
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeZipFile(zw, f.name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"gocv.io/x/gocv"
+)
+
+// ErrImageTooLarge 图片尺寸超过像素上限，在解码像素之前根据文件头判断
+var ErrImageTooLarge = errors.New("image dimensions exceed limits")
+
+// pixelLimits 解码前按文件头尺寸执行的像素限制，零值表示不限制
+type pixelLimits struct {
+	maxWidth     int
+	maxHeight    int
+	maxPixels    int64
+	decodePixels int64
+}
+
+var decodeLimits pixelLimits
+
+// SetPixelLimits 设置所有解码路径共用的像素限制，须在处理请求前调用
+func SetPixelLimits(cfg *config.UploadConfig) {
+	decodeLimits = pixelLimits{
+		maxWidth:     cfg.MaxWidth,
+		maxHeight:    cfg.MaxHeight,
+		maxPixels:    int64(cfg.MaxMegapixels * 1e6),
+		decodePixels: int64(cfg.DecodeMegapixels * 1e6),
+	}
+}
+
+// checkPixels 根据文件头中的尺寸检查像素上限，返回缩小解码的倍数（1、2、4 或 8）
+// 文件头中读不到尺寸的图片直接拒绝，不能交给解码器自行判断，否则限制可被绕过
+func checkPixels(info *imageInfo) (int, error) {
+	limits := decodeLimits
+	if info.Width <= 0 || info.Height <= 0 {
+		return 0, fmt.Errorf("%w: image dimensions cannot be read from header", ErrInvalidParam)
+	}
+
+	pixels := int64(info.Width) * int64(info.Height)
+	if (limits.maxWidth > 0 && info.Width > limits.maxWidth) ||
+		(limits.maxHeight > 0 && info.Height > limits.maxHeight) ||
+		(limits.maxPixels > 0 && pixels > limits.maxPixels) {
+		return 0, fmt.Errorf("%w: %dx%d (max %dx%d, %.1f MP)", ErrImageTooLarge,
+			info.Width, info.Height, limits.maxWidth, limits.maxHeight, float64(limits.maxPixels)/1e6)
+	}
+
+	if limits.decodePixels <= 0 {
+		return 1, nil
+	}
+	reduce := 1
+	for reduce < 8 && pixels/int64(reduce*reduce) > limits.decodePixels {
+		reduce *= 2
+	}
+	return reduce, nil
+}
+
+// reduceMat 按缩小倍数原地缩小图像，尺寸向上取整，与 OpenCV 缩小解码的输出尺寸一致
+func reduceMat(img *gocv.Mat, reduce int) {
+	if reduce <= 1 {
+		return
+	}
+	size := image.Point{X: (img.Cols() + reduce - 1) / reduce, Y: (img.Rows() + reduce - 1) / reduce}
+	gocv.Resize(*img, img, size, 0, 0, gocv.InterpolationArea)
+}
+
+// uprightSize 返回文件头中的尺寸按 EXIF Orientation 转正后的宽高
+func uprightSize(info *imageInfo, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return info.Height, info.Width
+	}
+	return info.Width, info.Height
+}
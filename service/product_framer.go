@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// ProductFramer 按构图预设将商品主体裁切并居中放置到纯色背景上
+type ProductFramer struct {
+	maskProcessor *MaskProcessor
+}
+
+func NewProductFramer() *ProductFramer {
+	return &ProductFramer{
+		maskProcessor: NewMaskProcessor(),
+	}
+}
+
+// Render 根据前景边界框裁切主体，按预设的宽高比、填充比例和留白缩放后放到背景中央
+func (pf *ProductFramer) Render(imageData []byte, result *model.LayerResult, preset config.FramingPreset) ([]byte, string, error) {
+	width, height, err := frameSize(preset.Aspect, preset.Width)
+	if err != nil {
+		return nil, "", err
+	}
+	if preset.FillRatio <= 0 || preset.FillRatio > 1 {
+		return nil, "", fmt.Errorf("%w: fill ratio must be in (0, 1]", ErrInvalidParam)
+	}
+	if preset.Padding < 0 || preset.Padding >= 0.5 {
+		return nil, "", fmt.Errorf("%w: padding must be in [0, 0.5)", ErrInvalidParam)
+	}
+	background, err := parseHexColor(preset.Background)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+
+	img, err := decodeImage(imageData)
+	if err != nil {
+		return nil, "", err
+	}
+	defer img.Close()
+
+	layer, err := foregroundLayer(result)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rect := image.Rect(layer.BoundingBox.X, layer.BoundingBox.Y,
+		layer.BoundingBox.X+layer.BoundingBox.Width, layer.BoundingBox.Y+layer.BoundingBox.Height).
+		Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if rect.Empty() {
+		return nil, "", fmt.Errorf("%w: foreground is empty", ErrInvalidParam)
+	}
+
+	mask, err := decodeMask(layer.Mask, img.Cols(), img.Rows())
+	if err != nil {
+		return nil, "", err
+	}
+	defer mask.Close()
+
+	alpha := pf.maskProcessor.Feather(&mask, 1)
+	defer alpha.Close()
+
+	subjectRegion := img.Region(rect)
+	subject := subjectRegion.Clone()
+	subjectRegion.Close()
+	defer subject.Close()
+
+	alphaRegion := alpha.Region(rect)
+	subjectAlpha := alphaRegion.Clone()
+	alphaRegion.Close()
+	defer subjectAlpha.Close()
+
+	// 主体按较紧的一边达到填充比例，同时不得侵入留白
+	fill := math.Min(preset.FillRatio, 1-2*preset.Padding)
+	scale := math.Min(fill*float64(width)/float64(rect.Dx()), fill*float64(height)/float64(rect.Dy()))
+	size := image.Point{
+		X: max(1, int(math.Round(float64(rect.Dx())*scale))),
+		Y: max(1, int(math.Round(float64(rect.Dy())*scale))),
+	}
+	interp := gocv.InterpolationArea
+	if scale > 1 {
+		interp = gocv.InterpolationLinear
+	}
+	gocv.Resize(subject, &subject, size, 0, 0, interp)
+	gocv.Resize(subjectAlpha, &subjectAlpha, size, 0, 0, interp)
+
+	canvas := solidMat(width, height, background)
+	defer canvas.Close()
+
+	origin := image.Point{X: (width - size.X) / 2, Y: (height - size.Y) / 2}
+	alphaBlend(&canvas, &subject, &subjectAlpha, origin)
+
+	return encodeImage(&canvas, preset.Format)
+}
+
+// frameSize 根据 "W:H" 形式的宽高比和输出宽度计算画布尺寸
+func frameSize(aspect string, width int) (int, int, error) {
+	if width <= 0 || width > 8000 {
+		return 0, 0, fmt.Errorf("%w: width must be in [1, 8000]", ErrInvalidParam)
+	}
+
+	parts := strings.Split(aspect, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%w: invalid aspect %q", ErrInvalidParam, aspect)
+	}
+	aw, err1 := strconv.ParseFloat(parts[0], 64)
+	ah, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || aw <= 0 || ah <= 0 {
+		return 0, 0, fmt.Errorf("%w: invalid aspect %q", ErrInvalidParam, aspect)
+	}
+
+	height := int(math.Round(float64(width) * ah / aw))
+	if height <= 0 || height > 8000 {
+		return 0, 0, fmt.Errorf("%w: height must be in [1, 8000]", ErrInvalidParam)
+	}
+
+	return width, height, nil
+}
@@ -52,18 +52,43 @@ func (s *RedisService) GetLayerResult(ctx context.Context, md5 string) (*model.L
 		return nil, err
 	}
 
+	// 结构版本或管线版本不一致的缓存不能直接返回
+	storedSchema, storedPipeline := result.SchemaVersion, result.PipelineVersion
+	migrated, ok := migrateResult(&result)
+	if !ok {
+		utils.Logger.Info("stale cache entry treated as miss",
+			zap.String("md5", md5),
+			zap.Int("schema_version", storedSchema),
+			zap.Int("pipeline_version", storedPipeline))
+		return nil, nil
+	}
+
+	if migrated {
+		utils.Logger.Info("cache entry migrated",
+			zap.String("md5", md5),
+			zap.Int("from_schema_version", storedSchema),
+			zap.Int("to_schema_version", result.SchemaVersion))
+		if err := s.setResult(ctx, key, &result, redis.KeepTTL); err != nil {
+			utils.Logger.Warn("failed to write back migrated cache entry",
+				zap.String("md5", md5), zap.Error(err))
+		}
+	}
+
 	return &result, nil
 }
 
 // SetLayerResult 设置分层结果到缓存
 func (s *RedisService) SetLayerResult(ctx context.Context, md5 string, result *model.LayerResult) error {
-	key := "layer:" + md5
+	return s.setResult(ctx, "layer:"+md5, result, s.ttl)
+}
+
+func (s *RedisService) setResult(ctx context.Context, key string, result *model.LayerResult, ttl time.Duration) error {
 	data, err := json.Marshal(result)
 	if err != nil {
 		return err
 	}
 
-	return s.client.Set(ctx, key, data, s.ttl).Err()
+	return s.client.Set(ctx, key, data, ttl).Err()
 }
 
 func (s *RedisService) Close() error {
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"github.com/TIANLI0/LayerKit/model"
+)
+
+// resultMigrations 缓存结果的结构迁移，键为源结构版本，每一步升级一个版本
+// 只有管线版本与当前一致的缓存才会迁移：同时递增了 PipelineVersion 的结构变化不需要（也不应）注册迁移。
+// 返回 false 表示新结构的字段无法由缓存内容得出（需要原图重新处理），该缓存视为未命中
+var resultMigrations = map[int]func(*model.LayerResult) bool{}
+
+// migrateResult 将缓存结果升级到当前结构版本，管线版本不一致、无法升级或由更新版本的服务写入时返回 false
+func migrateResult(r *model.LayerResult) (migrated bool, ok bool) {
+	// 旧管线的结果即使能迁移结构也需要重新处理，先于迁移检查
+	if r.PipelineVersion != PipelineVersion {
+		return false, false
+	}
+	if r.SchemaVersion > model.SchemaVersion {
+		return false, false
+	}
+
+	for r.SchemaVersion < model.SchemaVersion {
+		migrate, exists := resultMigrations[r.SchemaVersion]
+		if !exists || !migrate(r) {
+			return false, false
+		}
+		r.SchemaVersion++
+		migrated = true
+	}
+
+	return migrated, true
+}
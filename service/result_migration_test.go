@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/TIANLI0/LayerKit/model"
+)
+
+func TestMigrateResult(t *testing.T) {
+	tests := []struct {
+		name            string
+		schema          int
+		pipeline        int
+		migrations      map[int]func(*model.LayerResult) bool
+		wantMigrated    bool
+		wantOK          bool
+		wantAlphaPrior  string
+		wantSchemaAfter int
+	}{
+		{name: "current", schema: model.SchemaVersion, pipeline: PipelineVersion, wantOK: true, wantSchemaAfter: model.SchemaVersion},
+		{name: "old schema, old pipeline", schema: model.SchemaVersion - 1, pipeline: PipelineVersion - 1, wantSchemaAfter: model.SchemaVersion - 1},
+		{name: "current schema, old pipeline", schema: model.SchemaVersion, pipeline: PipelineVersion - 1, wantSchemaAfter: model.SchemaVersion},
+		{name: "unversioned", schema: 0, pipeline: 0},
+		{name: "newer schema", schema: model.SchemaVersion + 1, pipeline: PipelineVersion, wantSchemaAfter: model.SchemaVersion + 1},
+		{name: "old schema without migration", schema: model.SchemaVersion - 1, pipeline: PipelineVersion, wantSchemaAfter: model.SchemaVersion - 1},
+		{
+			name:     "old schema with migration",
+			schema:   model.SchemaVersion - 1,
+			pipeline: PipelineVersion,
+			migrations: map[int]func(*model.LayerResult) bool{
+				model.SchemaVersion - 1: func(r *model.LayerResult) bool {
+					r.AlphaPrior = AlphaPriorNone
+					return true
+				},
+			},
+			wantMigrated:    true,
+			wantOK:          true,
+			wantAlphaPrior:  AlphaPriorNone,
+			wantSchemaAfter: model.SchemaVersion,
+		},
+		{
+			name:     "migration rejects entry",
+			schema:   model.SchemaVersion - 1,
+			pipeline: PipelineVersion,
+			migrations: map[int]func(*model.LayerResult) bool{
+				model.SchemaVersion - 1: func(*model.LayerResult) bool { return false },
+			},
+			wantSchemaAfter: model.SchemaVersion - 1,
+		},
+	}
+
+	registered := resultMigrations
+	defer func() { resultMigrations = registered }()
+
+	for _, tt := range tests {
+		resultMigrations = tt.migrations
+		r := &model.LayerResult{SchemaVersion: tt.schema, PipelineVersion: tt.pipeline}
+		migrated, ok := migrateResult(r)
+		if migrated != tt.wantMigrated || ok != tt.wantOK {
+			t.Errorf("%s: migrateResult = (%v, %v), want (%v, %v)", tt.name, migrated, ok, tt.wantMigrated, tt.wantOK)
+		}
+		if ok && (r.SchemaVersion != tt.wantSchemaAfter || r.AlphaPrior != tt.wantAlphaPrior) {
+			t.Errorf("%s: got schema %d, alpha_prior %q", tt.name, r.SchemaVersion, r.AlphaPrior)
+		}
+	}
+}
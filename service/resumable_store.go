@@ -0,0 +1,418 @@
+package service
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/config"
+	"github.com/TIANLI0/LayerKit/utils"
+	"go.uber.org/zap"
+)
+
+// 断点续传上传的错误
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadLocked     = errors.New("upload is being written")
+	ErrOffsetMismatch   = errors.New("upload offset mismatch")
+	ErrUploadTooLarge   = errors.New("upload exceeds size limit")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// ChecksumAlgorithms 支持的校验和算法
+var ChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+// Checksum "<算法> <Base64 摘要>" 格式的校验和，与 tus 的 Upload-Checksum 头相同
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum 解析 "<算法> <Base64 摘要>" 格式的校验和
+func ParseChecksum(s string) (*Checksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return nil, fmt.Errorf("%w: checksum must be \"<algorithm> <base64 digest>\"", ErrInvalidParam)
+	}
+	checksum := &Checksum{Algorithm: strings.ToLower(algorithm)}
+	if checksum.newHash() == nil {
+		return nil, fmt.Errorf("%w: unsupported checksum algorithm %q", ErrInvalidParam, algorithm)
+	}
+	sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(sum) != checksum.newHash().Size() {
+		return nil, fmt.Errorf("%w: invalid %s digest", ErrInvalidParam, checksum.Algorithm)
+	}
+	checksum.Sum = sum
+	return checksum, nil
+}
+
+func (c *Checksum) newHash() hash.Hash {
+	switch c.Algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// ResumableUpload 一个断点续传上传的状态，与数据文件一起保存
+type ResumableUpload struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Expires  time.Time         `json:"expires"`
+	MD5      string            `json:"md5,omitempty"` // 上传完成并通过校验后计算
+}
+
+// Complete 是否已收到全部数据
+func (u *ResumableUpload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// ResumableStore 将断点续传上传的分片追加保存到磁盘，完成时校验整体校验和
+// 每个上传对应一个数据文件和一个 JSON 状态文件；同一上传同时只允许一个写入
+type ResumableStore struct {
+	dir        string
+	maxSize    int64
+	expiration time.Duration
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func NewResumableStore(cfg *config.ResumableConfig, uploadDir string) (*ResumableStore, error) {
+	dir := filepath.Join(uploadDir, "resumable")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create resumable upload dir: %w", err)
+	}
+	return &ResumableStore{
+		dir:        dir,
+		maxSize:    cfg.MaxSize,
+		expiration: cfg.Expiration,
+		active:     make(map[string]bool),
+	}, nil
+}
+
+// MaxSize 单个上传的大小上限
+func (s *ResumableStore) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Create 创建一个长度为 length 的空上传
+// metadata 中的 checksum 为整个文件的校验和，上传完成时校验
+func (s *ResumableStore) Create(length int64, metadata map[string]string) (*ResumableUpload, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: upload length must be positive", ErrInvalidParam)
+	}
+	if length > s.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", ErrUploadTooLarge, length, s.maxSize)
+	}
+	if checksum, ok := metadata["checksum"]; ok {
+		if _, err := ParseChecksum(checksum); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	u := &ResumableUpload{
+		ID:       id,
+		Length:   length,
+		Metadata: metadata,
+		Expires:  time.Now().Add(s.expiration),
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	f.Close()
+	if err := s.save(u); err != nil {
+		os.Remove(s.dataPath(id))
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get 读取上传状态，不存在或已过期时返回 ErrUploadNotFound
+func (s *ResumableStore) Get(id string) (*ResumableUpload, error) {
+	if !isHex32(id) {
+		return nil, ErrUploadNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	var u ResumableUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if time.Now().After(u.Expires) {
+		return nil, ErrUploadNotFound
+	}
+	return &u, nil
+}
+
+// Append 从 offset 处追加一个分片，checksum 非 nil 时校验该分片，不一致则丢弃整个分片
+// 传输中断时保留已收到的数据（校验分片时除外），客户端通过 HEAD 查询偏移后续传
+// 收到全部数据后校验整体校验和并计算 MD5，不一致时删除整个上传
+func (s *ResumableStore) Append(id string, offset int64, r io.Reader, checksum *Checksum) (*ResumableUpload, error) {
+	if !s.lock(id) {
+		return nil, ErrUploadLocked
+	}
+	defer s.unlock(id)
+
+	u, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != u.Offset {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrOffsetMismatch, u.Offset, offset)
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+
+	var w io.Writer = f
+	var h hash.Hash
+	if checksum != nil {
+		h = checksum.newHash()
+		w = io.MultiWriter(f, h)
+	}
+	n, copyErr := io.Copy(w, io.LimitReader(r, u.Length-u.Offset))
+	if copyErr == nil {
+		// 分片超出声明的长度
+		if extra, _ := io.ReadFull(r, make([]byte, 1)); extra > 0 {
+			copyErr = fmt.Errorf("%w: chunk exceeds upload length %d", ErrUploadTooLarge, u.Length)
+		}
+	}
+
+	discard := copyErr != nil && (checksum != nil || errors.Is(copyErr, ErrUploadTooLarge))
+	if copyErr == nil && checksum != nil && !bytes.Equal(h.Sum(nil), checksum.Sum) {
+		copyErr = fmt.Errorf("%w: chunk %s differs", ErrChecksumMismatch, checksum.Algorithm)
+		discard = true
+	}
+	if discard {
+		if err := f.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("failed to discard chunk: %w", err)
+		}
+		n = 0
+	}
+
+	u.Offset += n
+	u.Expires = time.Now().Add(s.expiration)
+	if copyErr == nil && u.Complete() && u.MD5 == "" {
+		if err := s.finish(u); err != nil {
+			s.remove(id)
+			return nil, err
+		}
+	}
+	if err := s.save(u); err != nil {
+		return nil, err
+	}
+	return u, copyErr
+}
+
+// finish 校验整个文件的校验和（如果创建时提供）并计算 MD5
+func (s *ResumableStore) finish(u *ResumableUpload) error {
+	f, err := os.Open(s.dataPath(u.ID))
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	var w io.Writer = md5Hash
+	var checksum *Checksum
+	var h hash.Hash
+	if value, ok := u.Metadata["checksum"]; ok {
+		if checksum, err = ParseChecksum(value); err != nil {
+			return err
+		}
+		h = checksum.newHash()
+		w = io.MultiWriter(md5Hash, h)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	if checksum != nil && !bytes.Equal(h.Sum(nil), checksum.Sum) {
+		return fmt.Errorf("%w: upload %s differs", ErrChecksumMismatch, checksum.Algorithm)
+	}
+
+	u.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	return nil
+}
+
+// Delete 删除上传及其数据，正在写入时返回 ErrUploadLocked
+func (s *ResumableStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if !s.lock(id) {
+		return ErrUploadLocked
+	}
+	defer s.unlock(id)
+	s.remove(id)
+	return nil
+}
+
+// Path 返回上传数据文件的路径
+func (s *ResumableStore) Path(u *ResumableUpload) string {
+	return s.dataPath(u.ID)
+}
+
+// Cleanup 删除已过期的上传，以及缺少状态文件的残留数据，返回删除的上传数
+func (s *ResumableStore) Cleanup() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		id := strings.TrimSuffix(name, ".json")
+		if !isHex32(id) || !s.lock(id) {
+			continue
+		}
+
+		expired := false
+		if name != id {
+			u, err := s.Get(id)
+			expired = errors.Is(err, ErrUploadNotFound) || (err == nil && now.After(u.Expires))
+		} else if _, err := os.Stat(s.infoPath(id)); errors.Is(err, os.ErrNotExist) {
+			// 创建过程中中断留下的数据文件
+			info, err := entry.Info()
+			expired = err == nil && now.Sub(info.ModTime()) > s.expiration
+		}
+		if expired {
+			s.remove(id)
+			removed++
+		}
+		s.unlock(id)
+	}
+	return removed, nil
+}
+
+// StartCleanup 在后台按 interval 定期清理过期的上传
+func (s *ResumableStore) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := s.Cleanup()
+			if err != nil {
+				utils.Logger.Warn("failed to clean up resumable uploads", zap.Error(err))
+				continue
+			}
+			if removed > 0 {
+				utils.Logger.Info("expired resumable uploads removed", zap.Int("count", removed))
+			}
+		}
+	}()
+}
+
+func (s *ResumableStore) save(u *ResumableUpload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免中断时留下不完整的状态
+	tmp := s.infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	if err := os.Rename(tmp, s.infoPath(u.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	return nil
+}
+
+func (s *ResumableStore) remove(id string) {
+	for _, path := range []string{s.infoPath(id), s.dataPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			utils.Logger.Warn("failed to delete upload file",
+				zap.String("file", path),
+				zap.Error(err))
+		}
+	}
+}
+
+func (s *ResumableStore) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[id] {
+		return false
+	}
+	s.active[id] = true
+	return true
+}
+
+func (s *ResumableStore) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, id)
+}
+
+func (s *ResumableStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *ResumableStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// newRandomID 生成随机 ID（上传 ID、任务 ID），地址即凭据，不能使用可预测的时间戳
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isHex32 检查是否为 32 位小写十六进制（上传 ID、任务 ID、MD5），用作文件名前防止路径穿越
+func isHex32(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"gocv.io/x/gocv"
+)
+
+// FrameSource 按顺序逐帧解码的序列，同一时刻只解码一帧，内存不随帧数增长
+type FrameSource interface {
+	// Len 返回帧数
+	Len() int
+	// Next 解码下一帧，返回 8 位 BGR 图像（由调用方释放）和显示时长（毫秒）；没有更多帧时返回 io.EOF
+	Next() (gocv.Mat, int, error)
+}
+
+// checkSequencePixels 解码前按帧数乘以每帧像素检查整个序列的像素预算
+func checkSequencePixels(frames int, framePixels, maxPixels int64) error {
+	if maxPixels > 0 && int64(frames)*framePixels > maxPixels {
+		return fmt.Errorf("%w: %d frames of %.1f MP exceed the sequence budget of %.1f MP", ErrImageTooLarge,
+			frames, float64(framePixels)/1e6, float64(maxPixels)/1e6)
+	}
+	return nil
+}
+
+// gifFrame GIF 中一帧的原始数据块
+type gifFrame struct {
+	gce      []byte // 图形控制扩展，没有时为 nil
+	block    []byte // 图像描述符、局部颜色表和 LZW 数据
+	delay    int    // 显示时长（毫秒）
+	disposal byte
+}
+
+// gifFrames GIF 动图的帧序列：先切分数据块，逐帧单独解码后按处置方式合成为完整画面
+type gifFrames struct {
+	header   []byte // 文件头、逻辑屏幕描述符和全局颜色表
+	frames   []gifFrame
+	canvas   *image.NRGBA
+	previous *image.NRGBA
+	next     int
+}
+
+// NewGIFFrames 切分 GIF 的帧，解码任何像素之前检查帧数、画布尺寸和整个序列的像素预算
+func NewGIFFrames(data []byte, maxFrames int, maxPixels int64) (FrameSource, error) {
+	info := probeImage(data)
+	if _, err := checkPixels(info); err != nil {
+		return nil, err
+	}
+	header, frames, err := splitGIF(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode gif: %v", ErrInvalidParam, err)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("%w: gif has no frames", ErrInvalidParam)
+	}
+	if len(frames) > maxFrames {
+		return nil, fmt.Errorf("%w: gif has %d frames, at most %d allowed", ErrInvalidParam, len(frames), maxFrames)
+	}
+	// 每一帧都按逻辑屏幕尺寸合成和分割
+	if err := checkSequencePixels(len(frames), int64(info.Width)*int64(info.Height), maxPixels); err != nil {
+		return nil, err
+	}
+
+	bounds := image.Rect(0, 0, info.Width, info.Height)
+	return &gifFrames{
+		header:   header,
+		frames:   frames,
+		canvas:   image.NewNRGBA(bounds),
+		previous: image.NewNRGBA(bounds),
+	}, nil
+}
+
+func (g *gifFrames) Len() int {
+	return len(g.frames)
+}
+
+func (g *gifFrames) Next() (gocv.Mat, int, error) {
+	if g.next >= len(g.frames) {
+		return gocv.NewMat(), 0, io.EOF
+	}
+	f := g.frames[g.next]
+	g.next++
+
+	// 以原文件头和该帧的数据块拼成单帧 GIF 解码，只分配这一帧
+	single := make([]byte, 0, len(g.header)+len(f.gce)+len(f.block)+1)
+	single = append(single, g.header...)
+	single = append(single, f.gce...)
+	single = append(single, f.block...)
+	single = append(single, 0x3B)
+	frame, err := gif.Decode(bytes.NewReader(single))
+	if err != nil {
+		return gocv.NewMat(), 0, fmt.Errorf("%w: failed to decode gif frame %d: %v", ErrInvalidParam, g.next-1, err)
+	}
+
+	if f.disposal == gif.DisposalPrevious {
+		copy(g.previous.Pix, g.canvas.Pix)
+	}
+	draw.Draw(g.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	img, err := imageToBGR(g.canvas)
+	if err != nil {
+		return gocv.NewMat(), 0, err
+	}
+
+	switch f.disposal {
+	case gif.DisposalBackground:
+		draw.Draw(g.canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	case gif.DisposalPrevious:
+		copy(g.canvas.Pix, g.previous.Pix)
+	}
+	return img, f.delay, nil
+}
+
+// splitGIF 不解压像素，遍历 GIF 数据块切分出文件头和各帧
+func splitGIF(data []byte) ([]byte, []gifFrame, error) {
+	if len(data) < 13 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+	if pos > len(data) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	header := data[:pos]
+
+	var frames []gifFrame
+	var gce []byte
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展
+			if pos+2 > len(data) {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			end, err := skipGIFSubBlocks(data, pos+2)
+			if err != nil {
+				return nil, nil, err
+			}
+			if data[pos+1] == 0xF9 {
+				gce = data[pos:end]
+			}
+			pos = end
+
+		case 0x2C: // 图像描述符
+			if pos+10 > len(data) {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			start := pos
+			if packed := data[pos+9]; packed&0x80 != 0 {
+				pos += 3 << (packed&0x07 + 1)
+			}
+			pos += 11 // 描述符 10 字节及 LZW 最小码长
+			end, err := skipGIFSubBlocks(data, pos)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// GIF 的延迟单位为 1/100 秒，0 按浏览器惯例视为 100ms
+			frame := gifFrame{gce: gce, block: data[start:end], delay: 100}
+			if len(gce) >= 8 {
+				frame.disposal = gce[3] >> 2 & 0x07
+				if delay := int(binary.LittleEndian.Uint16(gce[4:])); delay > 0 {
+					frame.delay = delay * 10
+				}
+			}
+			frames = append(frames, frame)
+			gce = nil
+			pos = end
+
+		case 0x3B: // 结束
+			return header, frames, nil
+
+		default:
+			return nil, nil, fmt.Errorf("unknown block 0x%02x", data[pos])
+		}
+	}
+	// 缺少结束标记时按已读到的帧处理
+	return header, frames, nil
+}
+
+// skipGIFSubBlocks 跳过从 pos 开始的数据子块序列，返回终止块之后的位置
+func skipGIFSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos, nil
+		}
+		pos += n
+	}
+}
+
+// imageFrames 按顺序排列的单帧图片
+type imageFrames struct {
+	images        [][]byte
+	delay         int
+	width, height int
+	next          int
+}
+
+// NewImageFrames 检查各帧文件头中的尺寸和整个序列的像素预算，所有帧需与第一帧尺寸一致
+func NewImageFrames(images [][]byte, delay int, maxPixels int64) (FrameSource, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%w: sequence has no frames", ErrInvalidParam)
+	}
+
+	var width, height int
+	for i, data := range images {
+		info := probeImage(data)
+		if _, err := checkPixels(info); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		w, h := uprightSize(info, exifOrientation(data))
+		if i == 0 {
+			width, height = w, h
+		} else if w != width || h != height {
+			return nil, fmt.Errorf("%w: frame %d is %dx%d, expected %dx%d", ErrInvalidParam, i, w, h, width, height)
+		}
+	}
+	if err := checkSequencePixels(len(images), int64(width)*int64(height), maxPixels); err != nil {
+		return nil, err
+	}
+
+	return &imageFrames{images: images, delay: delay, width: width, height: height}, nil
+}
+
+func (f *imageFrames) Len() int {
+	return len(f.images)
+}
+
+// Next 解码下一帧并转换为 sRGB
+func (f *imageFrames) Next() (gocv.Mat, int, error) {
+	if f.next >= len(f.images) {
+		return gocv.NewMat(), 0, io.EOF
+	}
+	i := f.next
+	f.next++
+
+	data := f.images[i]
+	img, err := decodeImage(data)
+	if err != nil {
+		return gocv.NewMat(), 0, fmt.Errorf("%w: frame %d: %v", ErrInvalidParam, i, err)
+	}
+	convertToSRGB(&img, probeImage(data).ICC)
+	return img, f.delay, nil
+}
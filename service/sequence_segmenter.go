@@ -0,0 +1,327 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"github.com/TIANLI0/LayerKit/utils"
+	"go.uber.org/zap"
+	"gocv.io/x/gocv"
+)
+
+// 序列分层的输出形式
+const (
+	SequenceOutputJSON      = "json"       // 逐帧图层
+	SequenceOutputMaskGIF   = "mask_gif"   // 黑白掩码动图
+	SequenceOutputCutoutGIF = "cutout_gif" // 背景透明的抠图动图
+)
+
+// sceneCutThreshold 相邻帧平均灰度差超过该值时视为切换镜头，不再沿用上一帧掩码
+const sceneCutThreshold = 40
+
+// SequenceFrameFunc 接收一帧图像及其前景掩码，返回错误时中止处理
+type SequenceFrameFunc func(frame, mask *gocv.Mat, delay int) error
+
+// ProcessSequence 逐帧解码并分层，后一帧以前一帧的掩码初始化 GrabCut，避免前景在帧间闪烁
+// 同一时刻只保留当前帧和上一帧，每帧分层后交给 onFrame（可为 nil）；整个序列只占用一个处理名额
+func (s *GrabCutService) ProcessSequence(frames FrameSource, md5 string, opts ProcessOptions, onFrame SequenceFrameFunc) (*model.SequenceResult, error) {
+	release, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	startTime := time.Now()
+	result := &model.SequenceResult{
+		PipelineVersion: PipelineVersion,
+		MD5:             md5,
+		Frames:          make([]model.SequenceFrame, 0, frames.Len()),
+		Timestamp:       time.Now().Unix(),
+	}
+
+	prevFrame := gocv.NewMat()
+	defer func() { prevFrame.Close() }()
+	prevMask := gocv.NewMat()
+	defer func() { prevMask.Close() }()
+	noAlpha := gocv.NewMat()
+	defer noAlpha.Close()
+
+	for i := 0; ; i++ {
+		frame, delay, err := frames.Next()
+		if errors.Is(err, io.EOF) {
+			frame.Close()
+			break
+		}
+		if err != nil {
+			frame.Close()
+			return nil, err
+		}
+		if i == 0 {
+			result.Width, result.Height = frame.Cols(), frame.Rows()
+		} else if frame.Cols() != result.Width || frame.Rows() != result.Height {
+			frame.Close()
+			return nil, fmt.Errorf("%w: frame %d is %dx%d, expected %dx%d", ErrInvalidParam, i,
+				frame.Cols(), frame.Rows(), result.Width, result.Height)
+		}
+
+		var fgMask gocv.Mat
+		seeded := false
+		if i > 0 && !isSceneCut(&prevFrame, &frame) {
+			fgMask, seeded = s.segmentSeeded(&frame, &prevMask)
+			if !seeded {
+				fgMask.Close()
+			}
+		}
+		if !seeded {
+			fgMask, _ = s.segment(&frame, &noAlpha, nil)
+		}
+
+		if opts.MaxForegroundOnly {
+			largest := s.maskProcessor.KeepLargest(&fgMask)
+			if largest.Ptr() != fgMask.Ptr() {
+				fgMask.Close()
+				fgMask = largest
+			}
+		}
+
+		fgConfidence := s.calculateConfidence(&fgMask, result.Width, result.Height)
+		result.Frames = append(result.Frames, model.SequenceFrame{
+			Index:  i,
+			Delay:  delay,
+			Seeded: seeded,
+			Layers: []model.Layer{
+				{
+					ID:          1,
+					Type:        "foreground",
+					BoundingBox: s.calculateBoundingBox(&fgMask),
+					Mask:        s.encodeMask(&fgMask),
+					Confidence:  fgConfidence,
+				},
+			},
+		})
+
+		if onFrame != nil {
+			if err := onFrame(&frame, &fgMask, delay); err != nil {
+				frame.Close()
+				fgMask.Close()
+				return nil, err
+			}
+		}
+
+		prevFrame.Close()
+		prevFrame = frame
+		prevMask.Close()
+		prevMask = fgMask
+	}
+
+	if len(result.Frames) == 0 {
+		return nil, fmt.Errorf("%w: sequence has no frames", ErrInvalidParam)
+	}
+
+	utils.Logger.Info("sequence processed",
+		zap.String("md5", md5),
+		zap.Int("frames", len(result.Frames)),
+		zap.Duration("duration", time.Since(startTime)))
+
+	return result, nil
+}
+
+// segmentSeeded 以上一帧的前景掩码初始化 GrabCut 分割当前帧
+// 上一帧掩码全空或全满时无法同时提供前景和背景样本，返回 false 由调用方重新分割
+func (s *GrabCutService) segmentSeeded(img, prevMask *gocv.Mat) (gocv.Mat, bool) {
+	scaledImg, _ := s.smartResize(img, 1200)
+	defer scaledImg.Close()
+	size := image.Point{X: scaledImg.Cols(), Y: scaledImg.Rows()}
+
+	prev := gocv.NewMat()
+	defer prev.Close()
+	gocv.Resize(*prevMask, &prev, size, 0, 0, gocv.InterpolationNearestNeighbor)
+
+	nonZero := gocv.CountNonZero(prev)
+	if nonZero == 0 || nonZero == size.X*size.Y {
+		return gocv.NewMat(), false
+	}
+
+	mask, ok := seedFromPrevious(&prev, max(2, min(size.X, size.Y)/50))
+	if !ok {
+		mask.Close()
+		return gocv.NewMat(), false
+	}
+	defer mask.Close()
+
+	bgdModel := gocv.NewMat()
+	defer bgdModel.Close()
+	fgdModel := gocv.NewMat()
+	defer fgdModel.Close()
+	gocv.GrabCut(scaledImg, &mask, image.Rectangle{}, &bgdModel, &fgdModel, max(2, s.iterations-2), gocv.GCInitWithMask)
+
+	fgMask := s.maskProcessor.ExtractForeground(&mask)
+	optimized := s.maskProcessor.MorphologyOptimize(&fgMask, 3)
+	fgMask.Close()
+	fgMask = optimized
+
+	if size.X != img.Cols() || size.Y != img.Rows() {
+		resized := gocv.NewMat()
+		gocv.Resize(fgMask, &resized, image.Point{X: img.Cols(), Y: img.Rows()}, 0, 0, gocv.InterpolationLinear)
+		gocv.Threshold(resized, &resized, 127, 255, gocv.ThresholdBinary)
+		fgMask.Close()
+		fgMask = resized
+	}
+
+	return fgMask, true
+}
+
+// seedFromPrevious 由上一帧的前景掩码生成 GrabCut 初始掩码：
+// 腐蚀后的前景为确定前景，膨胀后前景之外为确定背景，中间的过渡带按上一帧标为可能前景或可能背景
+func seedFromPrevious(prev *gocv.Mat, band int) (gocv.Mat, bool) {
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Point{X: 2*band + 1, Y: 2*band + 1})
+	defer kernel.Close()
+
+	eroded := gocv.NewMat()
+	defer eroded.Close()
+	gocv.Erode(*prev, &eroded, kernel)
+	dilated := gocv.NewMat()
+	defer dilated.Close()
+	gocv.Dilate(*prev, &dilated, kernel)
+
+	prevData, err := prev.DataPtrUint8()
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+	erodedData, err := eroded.DataPtrUint8()
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+	dilatedData, err := dilated.DataPtrUint8()
+	if err != nil {
+		return gocv.NewMat(), false
+	}
+
+	mask := gocv.NewMatWithSize(prev.Rows(), prev.Cols(), gocv.MatTypeCV8U)
+	maskData, err := mask.DataPtrUint8()
+	if err != nil {
+		return mask, false
+	}
+	for i := range maskData {
+		switch {
+		case erodedData[i] > 0:
+			maskData[i] = gcForeground
+		case dilatedData[i] == 0:
+			maskData[i] = gcBackground
+		case prevData[i] > 0:
+			maskData[i] = gcProbableForeground
+		default:
+			maskData[i] = gcProbableBackground
+		}
+	}
+
+	return mask, true
+}
+
+// isSceneCut 判断相邻两帧是否差异过大（镜头切换），此时上一帧掩码不再可靠
+func isSceneCut(prev, cur *gocv.Mat) bool {
+	prevGray := gocv.NewMat()
+	defer prevGray.Close()
+	gocv.CvtColor(*prev, &prevGray, gocv.ColorBGRToGray)
+	curGray := gocv.NewMat()
+	defer curGray.Close()
+	gocv.CvtColor(*cur, &curGray, gocv.ColorBGRToGray)
+
+	diff := gocv.NewMat()
+	defer diff.Close()
+	gocv.AbsDiff(prevGray, curGray, &diff)
+
+	return diff.Mean().Val1 > sceneCutThreshold
+}
+
+// SequenceGIFWriter 逐帧编码序列分层结果动图：mask_gif 为黑白掩码，cutout_gif 为背景透明的抠图
+// 每帧编码后只保留压缩数据，不需要同时持有所有帧的图像
+type SequenceGIFWriter struct {
+	output      string
+	buf         bytes.Buffer
+	palette     color.Palette
+	transparent uint8
+}
+
+// NewSequenceGIFWriter 创建指定输出形式的动图编码器
+func NewSequenceGIFWriter(output string) (*SequenceGIFWriter, error) {
+	w := &SequenceGIFWriter{output: output}
+	switch output {
+	case SequenceOutputMaskGIF:
+		w.palette = color.Palette{color.Black, color.White}
+	case SequenceOutputCutoutGIF:
+		// 抠图使用 Plan9 调色板的前 255 色，最后一个索引留给透明色
+		w.palette = append(color.Palette{}, palette.Plan9[:255]...)
+		w.palette = append(w.palette, color.Transparent)
+		w.transparent = uint8(len(w.palette) - 1)
+	default:
+		return nil, fmt.Errorf("%w: unknown sequence output %q", ErrInvalidParam, output)
+	}
+	return w, nil
+}
+
+// Add 编码一帧，可直接作为 ProcessSequence 的 onFrame
+func (w *SequenceGIFWriter) Add(frame, mask *gocv.Mat, delay int) error {
+	maskData, err := mask.DataPtrUint8()
+	if err != nil {
+		return err
+	}
+
+	bounds := image.Rect(0, 0, mask.Cols(), mask.Rows())
+	paletted := image.NewPaletted(bounds, w.palette)
+	if w.output == SequenceOutputMaskGIF {
+		for j, v := range maskData {
+			if v > 0 {
+				paletted.Pix[j] = 1
+			}
+		}
+	} else {
+		src, err := frame.ToImage()
+		if err != nil {
+			return err
+		}
+		draw.FloydSteinberg.Draw(paletted, bounds, src, image.Point{})
+		for j, v := range maskData {
+			if v == 0 {
+				paletted.Pix[j] = w.transparent
+			}
+		}
+	}
+
+	// 单独编码这一帧（局部颜色表），每帧都是完整画面，透明像素需要清除上一帧而不是透出上一帧
+	var single bytes.Buffer
+	err = gif.EncodeAll(&single, &gif.GIF{
+		Image:    []*image.Paletted{paletted},
+		Delay:    []int{max(1, delay/10)},
+		Disposal: []byte{gif.DisposalBackground},
+	})
+	if err != nil {
+		return err
+	}
+
+	// 单帧 GIF 为 13 字节文件头、图形控制扩展和图像块、1 字节结束标记
+	encoded := single.Bytes()
+	if w.buf.Len() == 0 {
+		w.buf.Write(encoded[:13])
+		// NETSCAPE2.0 应用扩展，循环次数 0 表示无限循环
+		w.buf.Write([]byte{0x21, 0xFF, 0x0B})
+		w.buf.WriteString("NETSCAPE2.0")
+		w.buf.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	}
+	w.buf.Write(encoded[13 : len(encoded)-1])
+	return nil
+}
+
+// Bytes 返回完整的动图数据
+func (w *SequenceGIFWriter) Bytes() []byte {
+	return append(w.buf.Bytes(), 0x3B)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"image"
+	"math"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// ShapeAnalyzer 负责从掩码计算形状描述
+type ShapeAnalyzer struct{}
+
+func NewShapeAnalyzer() *ShapeAnalyzer {
+	return &ShapeAnalyzer{}
+}
+
+// Describe 计算掩码的面积、质心、旋转外接矩形、主轴方向、凸包、实心度、周长和孔洞数
+func (sa *ShapeAnalyzer) Describe(mask *gocv.Mat) *model.Shape {
+	area := gocv.CountNonZero(*mask)
+	if area == 0 {
+		return &model.Shape{}
+	}
+
+	shape := &model.Shape{Area: area}
+
+	moments := gocv.Moments(*mask, true)
+	if m00 := moments["m00"]; m00 > 0 {
+		shape.Centroid = model.PointF{X: moments["m10"] / m00, Y: moments["m01"] / m00}
+		// 由二阶中心矩计算主轴方向
+		theta := 0.5 * math.Atan2(2*moments["mu11"], moments["mu20"]-moments["mu02"])
+		shape.Orientation = theta * 180 / math.Pi
+	}
+
+	hierarchy := gocv.NewMat()
+	defer hierarchy.Close()
+	contours := gocv.FindContoursWithParams(*mask, &hierarchy, gocv.RetrievalCComp, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	// 两级层次结构中，有父轮廓的即为孔洞
+	var outer []gocv.PointVector
+	for i := 0; i < contours.Size(); i++ {
+		if hierarchy.GetVeciAt(0, i)[3] >= 0 {
+			shape.Holes++
+			continue
+		}
+		outer = append(outer, contours.At(i))
+	}
+
+	points := gocv.NewPointVector()
+	defer points.Close()
+	for _, c := range outer {
+		shape.Perimeter += gocv.ArcLength(c, true)
+		for _, p := range c.ToPoints() {
+			points.Append(p)
+		}
+	}
+	if points.Size() == 0 {
+		return shape
+	}
+
+	rect := gocv.MinAreaRect2f(points)
+	shape.RotatedBox = model.RotatedBox{
+		Center: model.PointF{X: float64(rect.Center.X), Y: float64(rect.Center.Y)},
+		Width:  float64(rect.Width),
+		Height: float64(rect.Height),
+		Angle:  rect.Angle,
+	}
+	for _, p := range rect.Points {
+		shape.RotatedBox.Points = append(shape.RotatedBox.Points, model.PointF{X: float64(p.X), Y: float64(p.Y)})
+	}
+
+	hull := gocv.NewMat()
+	defer hull.Close()
+	gocv.ConvexHull(points, &hull, true, true)
+
+	hullPoints := make([]model.Point, 0, hull.Rows())
+	hullVector := gocv.NewPointVector()
+	defer hullVector.Close()
+	for i := 0; i < hull.Rows(); i++ {
+		v := hull.GetVeciAt(i, 0)
+		hullPoints = append(hullPoints, model.Point{X: int(v[0]), Y: int(v[1])})
+		hullVector.Append(image.Point{X: int(v[0]), Y: int(v[1])})
+	}
+	shape.ConvexHull = hullPoints
+
+	if hullArea := gocv.ContourArea(hullVector); hullArea > 0 {
+		shape.Solidity = math.Min(1, float64(area)/hullArea)
+	}
+
+	return shape
+}
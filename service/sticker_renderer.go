@@ -0,0 +1,325 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
+// StickerSize 贴纸输出尺寸
+type StickerSize struct {
+	Size   int  // 长边像素，0 表示保持裁剪后的原始尺寸
+	Square bool // 是否补齐为 Size x Size 的正方形
+}
+
+// StickerSizes 常见平台的贴纸尺寸
+var StickerSizes = map[string]StickerSize{
+	"original":       {Size: 0},
+	"whatsapp":       {Size: 512, Square: true},
+	"telegram":       {Size: 512},
+	"imessage-small": {Size: 300, Square: true},
+	"imessage":       {Size: 408, Square: true},
+	"imessage-large": {Size: 618, Square: true},
+}
+
+// StickerSpec 贴纸渲染参数
+type StickerSpec struct {
+	OutlineWidth  int     // 描边宽度（像素），0 表示不描边
+	OutlineColor  string  // 描边颜色
+	Shadow        bool    // 是否添加投影
+	ShadowColor   string  // 投影颜色
+	ShadowOffsetX int     // 投影水平偏移（像素）
+	ShadowOffsetY int     // 投影垂直偏移（像素）
+	ShadowBlur    int     // 投影模糊半径（像素）
+	ShadowOpacity float64 // 投影不透明度 0-1
+	Size          string  // 输出尺寸，取 StickerSizes 中的名称
+	Format        string  // 输出格式：png, webp
+}
+
+// StickerRenderer 将前景主体渲染为带描边和投影的透明贴纸
+type StickerRenderer struct {
+	maskProcessor *MaskProcessor
+}
+
+func NewStickerRenderer() *StickerRenderer {
+	return &StickerRenderer{
+		maskProcessor: NewMaskProcessor(),
+	}
+}
+
+// Render 生成裁剪到内容边界的透明贴纸
+func (sr *StickerRenderer) Render(imageData []byte, result *model.LayerResult, spec StickerSpec) ([]byte, string, error) {
+	size, ok := StickerSizes[spec.Size]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: unknown sticker size %q", ErrInvalidParam, spec.Size)
+	}
+	format := strings.ToLower(spec.Format)
+	if format != "png" && format != "webp" {
+		return nil, "", fmt.Errorf("%w: sticker format must be png or webp", ErrInvalidParam)
+	}
+	if spec.OutlineWidth < 0 || spec.OutlineWidth > 100 {
+		return nil, "", fmt.Errorf("%w: outline width must be in [0, 100]", ErrInvalidParam)
+	}
+	if spec.ShadowBlur < 0 || spec.ShadowBlur > 100 {
+		return nil, "", fmt.Errorf("%w: shadow blur must be in [0, 100]", ErrInvalidParam)
+	}
+	if spec.ShadowOffsetX < -100 || spec.ShadowOffsetX > 100 || spec.ShadowOffsetY < -100 || spec.ShadowOffsetY > 100 {
+		return nil, "", fmt.Errorf("%w: shadow offset must be in [-100, 100]", ErrInvalidParam)
+	}
+	if spec.ShadowOpacity < 0 || spec.ShadowOpacity > 1 {
+		return nil, "", fmt.Errorf("%w: shadow opacity must be in [0, 1]", ErrInvalidParam)
+	}
+
+	outlineColor, err := parseHexColor(spec.OutlineColor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	shadowColor, err := parseHexColor(spec.ShadowColor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+
+	img, err := decodeImage(imageData)
+	if err != nil {
+		return nil, "", err
+	}
+	defer img.Close()
+
+	layer, err := foregroundLayer(result)
+	if err != nil {
+		return nil, "", err
+	}
+	if layer.BoundingBox.Width == 0 || layer.BoundingBox.Height == 0 {
+		return nil, "", fmt.Errorf("%w: foreground is empty", ErrInvalidParam)
+	}
+
+	mask, err := decodeMask(layer.Mask, img.Cols(), img.Rows())
+	if err != nil {
+		return nil, "", err
+	}
+	defer mask.Close()
+
+	// 在主体边界框外留出描边和投影所需的空间
+	pad := spec.OutlineWidth + 2
+	if spec.Shadow {
+		pad += spec.ShadowBlur*2 + max(abs(spec.ShadowOffsetX), abs(spec.ShadowOffsetY))
+	}
+	subject, subjectMask := sr.cropWithPadding(&img, &mask, layer.BoundingBox, pad)
+	defer subject.Close()
+	defer subjectMask.Close()
+
+	// 轻微模糊掩码作为抗锯齿 alpha
+	subjectAlpha := sr.maskProcessor.Feather(&subjectMask, 1)
+	defer subjectAlpha.Close()
+
+	silhouette := subjectAlpha.Clone()
+	defer silhouette.Close()
+
+	var outlineAlpha gocv.Mat
+	if spec.OutlineWidth > 0 {
+		expanded := sr.maskProcessor.Expand(&subjectMask, spec.OutlineWidth)
+		outlineAlpha = sr.maskProcessor.Feather(&expanded, 1)
+		expanded.Close()
+		defer outlineAlpha.Close()
+
+		silhouette.Close()
+		silhouette = outlineAlpha.Clone()
+	}
+
+	width, height := subject.Cols(), subject.Rows()
+	canvas := make([]uint8, width*height*4)
+
+	if spec.Shadow && spec.ShadowOpacity > 0 {
+		shadowAlpha := sr.shadowAlpha(&silhouette, spec)
+		if err := drawLayer(canvas, nil, shadowColor, &shadowAlpha); err != nil {
+			shadowAlpha.Close()
+			return nil, "", err
+		}
+		shadowAlpha.Close()
+	}
+	if spec.OutlineWidth > 0 {
+		if err := drawLayer(canvas, nil, outlineColor, &outlineAlpha); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := drawLayer(canvas, &subject, color.RGBA{}, &subjectAlpha); err != nil {
+		return nil, "", err
+	}
+
+	sticker, err := sr.trimAndResize(canvas, width, height, size)
+	if err != nil {
+		return nil, "", err
+	}
+	defer sticker.Close()
+
+	return encodeImage(&sticker, format)
+}
+
+// cropWithPadding 按边界框外扩 pad 像素裁剪原图和掩码，超出原图的部分以透明（掩码为 0）填充
+func (sr *StickerRenderer) cropWithPadding(img, mask *gocv.Mat, bbox model.BBox, pad int) (gocv.Mat, gocv.Mat) {
+	paddedImg := gocv.NewMat()
+	defer paddedImg.Close()
+	gocv.CopyMakeBorder(*img, &paddedImg, pad, pad, pad, pad, gocv.BorderConstant, color.RGBA{})
+
+	paddedMask := gocv.NewMat()
+	defer paddedMask.Close()
+	gocv.CopyMakeBorder(*mask, &paddedMask, pad, pad, pad, pad, gocv.BorderConstant, color.RGBA{})
+
+	rect := image.Rect(bbox.X, bbox.Y, bbox.X+bbox.Width+pad*2, bbox.Y+bbox.Height+pad*2).
+		Intersect(image.Rect(0, 0, paddedImg.Cols(), paddedImg.Rows()))
+
+	imgRegion := paddedImg.Region(rect)
+	defer imgRegion.Close()
+	maskRegion := paddedMask.Region(rect)
+	defer maskRegion.Close()
+
+	return imgRegion.Clone(), maskRegion.Clone()
+}
+
+// shadowAlpha 平移并模糊轮廓生成投影 alpha
+func (sr *StickerRenderer) shadowAlpha(silhouette *gocv.Mat, spec StickerSpec) gocv.Mat {
+	shifted := gocv.NewMatWithSize(silhouette.Rows(), silhouette.Cols(), gocv.MatTypeCV8U)
+	shifted.SetTo(gocv.NewScalar(0, 0, 0, 0))
+
+	bounds := image.Rect(0, 0, silhouette.Cols(), silhouette.Rows())
+	offset := image.Point{X: spec.ShadowOffsetX, Y: spec.ShadowOffsetY}
+	dstRect := bounds.Add(offset).Intersect(bounds)
+	if !dstRect.Empty() {
+		srcRegion := silhouette.Region(dstRect.Sub(offset))
+		dstRegion := shifted.Region(dstRect)
+		srcRegion.CopyTo(&dstRegion)
+		srcRegion.Close()
+		dstRegion.Close()
+	}
+
+	blurred := sr.maskProcessor.Feather(&shifted, spec.ShadowBlur)
+	shifted.Close()
+	blurred.ConvertToWithParams(&blurred, gocv.MatTypeCV8U, float32(spec.ShadowOpacity), 0)
+
+	return blurred
+}
+
+// trimAndResize 裁剪到不透明内容的边界，并按目标尺寸缩放（透明区域补齐）
+func (sr *StickerRenderer) trimAndResize(canvas []uint8, width, height int, size StickerSize) (gocv.Mat, error) {
+	minX, minY, maxX, maxY := width, height, -1, -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if canvas[(y*width+x)*4+3] > 0 {
+				minX, maxX = min(minX, x), max(maxX, x)
+				minY, maxY = min(minY, y), max(maxY, y)
+			}
+		}
+	}
+	bounds := image.Rect(minX, minY, maxX+1, maxY+1)
+	if maxX < 0 {
+		return gocv.NewMat(), fmt.Errorf("%w: sticker is empty", ErrInvalidParam)
+	}
+
+	// 预乘 alpha 后再缩放，避免透明像素的颜色在边缘产生暗边
+	premultiply(canvas)
+	full, err := gocv.NewMatFromBytes(height, width, gocv.MatTypeCV8UC4, canvas)
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	defer full.Close()
+
+	region := full.Region(bounds)
+	trimmed := region.Clone()
+	region.Close()
+
+	if size.Size > 0 {
+		scale := float64(size.Size) / float64(max(bounds.Dx(), bounds.Dy()))
+		target := image.Point{
+			X: max(1, int(math.Round(float64(bounds.Dx())*scale))),
+			Y: max(1, int(math.Round(float64(bounds.Dy())*scale))),
+		}
+		interp := gocv.InterpolationArea
+		if scale > 1 {
+			interp = gocv.InterpolationLinear
+		}
+		gocv.Resize(trimmed, &trimmed, target, 0, 0, interp)
+
+		if size.Square {
+			padX := size.Size - target.X
+			padY := size.Size - target.Y
+			gocv.CopyMakeBorder(trimmed, &trimmed, padY/2, padY-padY/2, padX/2, padX-padX/2, gocv.BorderConstant, color.RGBA{})
+		}
+	}
+
+	data, err := trimmed.DataPtrUint8()
+	if err != nil {
+		trimmed.Close()
+		return gocv.NewMat(), err
+	}
+	unpremultiply(data)
+
+	return trimmed, nil
+}
+
+// drawLayer 以 source-over 方式将一层绘制到 BGRA 画布上
+// src 为空时使用纯色 c，alpha 为与画布同尺寸的 8 位单通道图像
+func drawLayer(canvas []uint8, src *gocv.Mat, c color.RGBA, alpha *gocv.Mat) error {
+	alphaData, err := alpha.DataPtrUint8()
+	if err != nil {
+		return err
+	}
+	var srcData []uint8
+	if src != nil {
+		if srcData, err = src.DataPtrUint8(); err != nil {
+			return err
+		}
+	}
+
+	for i, a := range alphaData {
+		if a == 0 {
+			continue
+		}
+		var b, g, r uint8
+		if srcData != nil {
+			b, g, r = srcData[i*3], srcData[i*3+1], srcData[i*3+2]
+		} else {
+			b, g, r = c.B, c.G, c.R
+		}
+
+		sa := float64(a) / 255
+		da := float64(canvas[i*4+3]) / 255
+		outA := sa + da*(1-sa)
+		blend := func(sc, dc uint8) uint8 {
+			return uint8((float64(sc)*sa+float64(dc)*da*(1-sa))/outA + 0.5)
+		}
+		canvas[i*4] = blend(b, canvas[i*4])
+		canvas[i*4+1] = blend(g, canvas[i*4+1])
+		canvas[i*4+2] = blend(r, canvas[i*4+2])
+		canvas[i*4+3] = uint8(outA*255 + 0.5)
+	}
+
+	return nil
+}
+
+// premultiply 将 BGRA 数据的颜色通道乘以 alpha
+func premultiply(data []uint8) {
+	for i := 0; i+3 < len(data); i += 4 {
+		a := int(data[i+3])
+		for ch := 0; ch < 3; ch++ {
+			data[i+ch] = uint8((int(data[i+ch])*a + 127) / 255)
+		}
+	}
+}
+
+// unpremultiply 将预乘 alpha 的 BGRA 数据还原为直通 alpha
+func unpremultiply(data []uint8) {
+	for i := 0; i+3 < len(data); i += 4 {
+		a := int(data[i+3])
+		if a == 0 || a == 255 {
+			continue
+		}
+		for ch := 0; ch < 3; ch++ {
+			data[i+ch] = uint8(min(255, (int(data[i+ch])*255+a/2)/a))
+		}
+	}
+}
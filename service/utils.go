@@ -1,5 +1,17 @@
 package service
 
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/TIANLI0/LayerKit/model"
+	"gocv.io/x/gocv"
+)
+
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -13,3 +25,134 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// foregroundLayer 返回分层结果中的前景图层
+func foregroundLayer(result *model.LayerResult) (*model.Layer, error) {
+	for i := range result.Layers {
+		if result.Layers[i].Type == "foreground" {
+			return &result.Layers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("foreground layer not found")
+}
+
+// decodeMask 将Base64编码的掩码解码为单通道Mat，并缩放到指定尺寸
+func decodeMask(encoded string, width, height int) (gocv.Mat, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return gocv.NewMat(), fmt.Errorf("invalid mask encoding: %w", err)
+	}
+
+	mask, err := gocv.IMDecode(data, gocv.IMReadGrayScale)
+	if err != nil || mask.Empty() {
+		mask.Close()
+		return gocv.NewMat(), fmt.Errorf("failed to decode mask")
+	}
+
+	if mask.Cols() != width || mask.Rows() != height {
+		resized := gocv.NewMat()
+		gocv.Resize(mask, &resized, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationNearestNeighbor)
+		mask.Close()
+		mask = resized
+	}
+
+	return mask, nil
+}
+
+// parseHexColor 解析 #RRGGBB 或 #RGB 格式的颜色
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color: %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color: %q", s)
+	}
+
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// encodeImage 按输出格式编码图像，返回数据和对应的 Content-Type
+func encodeImage(img *gocv.Mat, format string) ([]byte, string, error) {
+	var ext gocv.FileExt
+	var contentType string
+	var params []int
+
+	switch strings.ToLower(format) {
+	case "", "png":
+		ext, contentType = gocv.PNGFileExt, "image/png"
+	case "jpg", "jpeg":
+		ext, contentType = gocv.JPEGFileExt, "image/jpeg"
+		params = []int{gocv.IMWriteJpegQuality, 92}
+	case "webp":
+		ext, contentType = gocv.FileExt(".webp"), "image/webp"
+		params = []int{gocv.IMWriteWebpQuality, 90}
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported output format: %s", ErrInvalidParam, format)
+	}
+
+	buf, err := gocv.IMEncodeWithParams(ext, *img, params)
+	if err != nil {
+		return nil, "", err
+	}
+	defer buf.Close()
+
+	// 复制数据，NativeByteBuffer 关闭后底层内存会被释放
+	data := make([]byte, buf.Len())
+	copy(data, buf.GetBytes())
+
+	return data, contentType, nil
+}
+
+// alphaBlend 按 alpha 将 src 叠加到 dst 的 origin 位置（原地修改 dst），超出 dst 的部分被裁剪
+// dst、src 为 8 位 BGR 图像，alpha 为与 src 同尺寸的 8 位单通道图像，三者均需内存连续
+func alphaBlend(dst, src, alpha *gocv.Mat, origin image.Point) {
+	dstData, err := dst.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	srcData, err := src.DataPtrUint8()
+	if err != nil {
+		return
+	}
+	alphaData, err := alpha.DataPtrUint8()
+	if err != nil {
+		return
+	}
+
+	dw, dh := dst.Cols(), dst.Rows()
+	sw, sh := src.Cols(), src.Rows()
+	for y := 0; y < sh; y++ {
+		ty := origin.Y + y
+		if ty < 0 || ty >= dh {
+			continue
+		}
+		for x := 0; x < sw; x++ {
+			tx := origin.X + x
+			if tx < 0 || tx >= dw {
+				continue
+			}
+			a := int(alphaData[y*sw+x])
+			if a == 0 {
+				continue
+			}
+			si := (y*sw + x) * 3
+			di := (ty*dw + tx) * 3
+			for ch := 0; ch < 3; ch++ {
+				dstData[di+ch] = uint8((int(srcData[si+ch])*a + int(dstData[di+ch])*(255-a) + 127) / 255)
+			}
+		}
+	}
+}
@@ -23,6 +23,15 @@ func FileMD5(filePath string) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// ReaderMD5 计算读取内容的MD5
+func ReaderMD5(r io.Reader) (string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // BytesMD5 计算字节数组MD5
 func BytesMD5(data []byte) string {
 	hash := md5.New()